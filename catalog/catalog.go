@@ -0,0 +1,109 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yakiroren/dss-common/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Field names of models.FileMetadata as they are stored in mongo.
+const (
+	FieldID             = "_id"
+	FieldCreationTime   = "creationTime"
+	FieldName           = "name"
+	FieldSize           = "size"
+	FieldCurrentSize    = "currentSize"
+	FieldIsDirectory    = "isDirectory"
+	FieldPath           = "path"
+	FieldFragments      = "fragments"
+	FieldTags           = "tags"
+	FieldTotalFragments = "totalfragments"
+	FieldIsHidden       = "ishidden"
+)
+
+// Catalog runs the queries the db.DataStore interface has no room for
+// (pagination, aggregation, search) directly against the files collection.
+type Catalog struct {
+	files    *mongo.Collection
+	versions *mongo.Collection
+	keys     *mongo.Collection
+	client   *mongo.Client
+}
+
+func New(store *db.MongoDataStore) (*Catalog, error) {
+	files := store.FilesCollection
+
+	catalog := &Catalog{
+		files:    files,
+		versions: files.Database().Collection(files.Name() + versionsSuffix),
+		keys:     files.Database().Collection(files.Name() + keysSuffix),
+		client:   store.Client,
+	}
+
+	if err := catalog.createIndexes(context.Background()); err != nil {
+		return nil, err
+	}
+
+	if err := catalog.createVersionIndexes(context.Background()); err != nil {
+		return nil, err
+	}
+
+	if err := catalog.createKeyIndexes(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return catalog, nil
+}
+
+// WithTransaction runs fn in a transaction, the context passed to fn must
+// be used for every operation that should be part of it. Transactions need
+// mongo to run as a replica set.
+func (c *Catalog) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := c.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessionContext mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessionContext)
+	})
+
+	return err
+}
+
+func (c *Catalog) createIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: FieldPath, Value: 1}, {Key: FieldName, Value: 1}, {Key: FieldID, Value: 1}}},
+		{Keys: bson.D{{Key: FieldPath, Value: 1}, {Key: FieldSize, Value: 1}, {Key: FieldID, Value: 1}}},
+		{Keys: bson.D{{Key: FieldPath, Value: 1}, {Key: FieldCreationTime, Value: 1}, {Key: FieldID, Value: 1}}},
+		// search indexes, tags is a multikey index over every tag of a file.
+		{Keys: bson.D{{Key: FieldName, Value: 1}, {Key: FieldID, Value: 1}}},
+		// names are searched by their words, without stemming or stop words.
+		{Keys: bson.D{{Key: FieldName, Value: "text"}}, Options: options.Index().SetDefaultLanguage("none")},
+		{Keys: bson.D{{Key: FieldTags, Value: 1}}},
+		{Keys: bson.D{{Key: FieldSize, Value: 1}, {Key: FieldID, Value: 1}}},
+		{Keys: bson.D{{Key: FieldCreationTime, Value: 1}, {Key: FieldID, Value: 1}}},
+	}
+
+	if _, err := c.files.Indexes().CreateMany(ctx, indexes); err != nil {
+		return err
+	}
+
+	// a name can only be taken once per directory, this is what stops two
+	// concurrent uploads from both claiming the same free name.
+	unique := mongo.IndexModel{
+		Keys:    bson.D{{Key: FieldPath, Value: 1}, {Key: FieldName, Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	if _, err := c.files.Indexes().CreateOne(ctx, unique); err != nil {
+		return fmt.Errorf("could not create the unique (path, name) index, duplicate names must be removed: %w", err)
+	}
+
+	return nil
+}
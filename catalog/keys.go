@@ -0,0 +1,91 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const keysSuffix = "_keys"
+
+var ErrKeyNotFound = errors.New("api key not found")
+
+// APIKey is a key of the api. Only the sha256 of the secret is stored, the
+// secret itself is shown once when the key is issued.
+type APIKey struct {
+	ID      primitive.ObjectID `bson:"_id"`
+	Name    string             `bson:"name"`
+	Hash    string             `bson:"hash"`
+	Admin   bool               `bson:"admin"`
+	Created int64              `bson:"created"`
+	Revoked int64              `bson:"revoked,omitempty"`
+}
+
+func (c *Catalog) createKeyIndexes(ctx context.Context) error {
+	_, err := c.keys.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "hash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// CreateKey stores a new key, its id and creation time are set here.
+func (c *Catalog) CreateKey(ctx context.Context, key *APIKey) error {
+	key.ID = primitive.NewObjectID()
+	key.Created = time.Now().Unix()
+
+	_, err := c.keys.InsertOne(ctx, key)
+	return err
+}
+
+// KeyByHash returns the key with the hash of a secret, revoked keys are
+// never returned.
+func (c *Catalog) KeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	filter := bson.D{{Key: "hash", Value: hash}, {Key: "revoked", Value: bson.M{"$exists": false}}}
+
+	key := &APIKey{}
+
+	err := c.keys.FindOne(ctx, filter).Decode(key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrKeyNotFound
+	}
+
+	return key, err
+}
+
+// Keys returns every key, revoked ones included, oldest first.
+func (c *Catalog) Keys(ctx context.Context) ([]APIKey, error) {
+	cursor, err := c.keys.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: FieldID, Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []APIKey{}
+	if err = cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// RevokeKey marks a key as revoked, it is kept so that listing the keys
+// shows when it stopped working.
+func (c *Catalog) RevokeKey(ctx context.Context, id primitive.ObjectID) error {
+	filter := bson.D{{Key: FieldID, Value: id}, {Key: "revoked", Value: bson.M{"$exists": false}}}
+
+	result, err := c.keys.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revoked": time.Now().Unix()}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrKeyNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,401 @@
+package catalog
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/yakiroren/dss-common/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type SortField string
+
+const (
+	SortName    SortField = "name"
+	SortSize    SortField = "size"
+	SortCreated SortField = "created"
+)
+
+func (f SortField) key() string {
+	switch f {
+	case SortSize:
+		return FieldSize
+	case SortCreated:
+		return FieldCreationTime
+	case SortName:
+	}
+
+	return FieldName
+}
+
+func (f SortField) Valid() bool {
+	return f == SortName || f == SortSize || f == SortCreated
+}
+
+type Kind string
+
+const (
+	KindAny  Kind = ""
+	KindFile Kind = "file"
+	KindDir  Kind = "dir"
+)
+
+func (k Kind) Valid() bool {
+	return k == KindAny || k == KindFile || k == KindDir
+}
+
+// Query selects files by their metadata, empty fields are ignored. Text
+// matches names holding every word of it through the text index on names.
+type Query struct {
+	Path          string
+	PathPrefix    string
+	Kind          Kind
+	Processing    *bool
+	Text          string
+	NameGlob      string
+	Extension     string
+	Tags          []string
+	MinSize       *int64
+	MaxSize       *int64
+	CreatedAfter  *int64
+	CreatedBefore *int64
+}
+
+func (q Query) Filter() bson.D {
+	// the root directory is stored as a child of itself, never list it.
+	filter := bson.D{{Key: FieldName, Value: bson.M{"$ne": "/"}}}
+
+	if q.Path != "" {
+		filter = append(filter, bson.E{Key: FieldPath, Value: q.Path})
+	} else if q.PathPrefix != "" {
+		filter = append(filter, bson.E{Key: FieldPath, Value: bson.M{"$regex": SubtreePattern(q.PathPrefix, 0)}})
+	}
+
+	if search := textSearch(q.Text); search != "" {
+		filter = append(filter, bson.E{Key: "$text", Value: bson.M{"$search": search}})
+	}
+
+	filter = append(filter, q.nameFilter()...)
+
+	if len(q.Tags) > 0 {
+		filter = append(filter, bson.E{Key: FieldTags, Value: bson.M{"$all": q.Tags}})
+	}
+
+	if size := rangeFilter(q.MinSize, q.MaxSize); size != nil {
+		filter = append(filter, bson.E{Key: FieldSize, Value: size})
+	}
+
+	if created := rangeFilter(q.CreatedAfter, q.CreatedBefore); created != nil {
+		filter = append(filter, bson.E{Key: FieldCreationTime, Value: created})
+	}
+
+	switch q.Kind {
+	case KindFile:
+		filter = append(filter, bson.E{Key: FieldIsDirectory, Value: false})
+	case KindDir:
+		filter = append(filter, bson.E{Key: FieldIsDirectory, Value: true})
+	case KindAny:
+	}
+
+	if q.Processing != nil {
+		filter = append(filter, bson.E{Key: FieldIsHidden, Value: *q.Processing})
+	}
+
+	return filter
+}
+
+func (q Query) nameFilter() bson.D {
+	var patterns bson.A
+
+	if q.NameGlob != "" {
+		patterns = append(patterns, primitive.Regex{Pattern: GlobPattern(q.NameGlob)})
+	}
+
+	if q.Extension != "" {
+		extension := "." + strings.TrimPrefix(q.Extension, ".")
+		patterns = append(patterns, primitive.Regex{Pattern: regexp.QuoteMeta(extension) + "$", Options: "i"})
+	}
+
+	var filter bson.D
+	for _, pattern := range patterns {
+		filter = append(filter, bson.E{Key: FieldName, Value: pattern})
+	}
+
+	if len(filter) > 1 {
+		// a document can't repeat a key, so several name patterns need an $and.
+		var all bson.A
+		for _, condition := range filter {
+			all = append(all, bson.D{condition})
+		}
+
+		return bson.D{{Key: "$and", Value: all}}
+	}
+
+	return filter
+}
+
+// textSearch quotes every word of text, so the text index only matches
+// names holding all of them and the words are never read as negations.
+func textSearch(text string) string {
+	words := strings.Fields(strings.ReplaceAll(text, `"`, " "))
+	for i, word := range words {
+		words[i] = `"` + word + `"`
+	}
+
+	return strings.Join(words, " ")
+}
+
+func rangeFilter(min *int64, max *int64) bson.M {
+	if min == nil && max == nil {
+		return nil
+	}
+
+	bounds := bson.M{}
+	if min != nil {
+		bounds["$gte"] = *min
+	}
+	if max != nil {
+		bounds["$lte"] = *max
+	}
+
+	return bounds
+}
+
+// GlobPattern translates a shell glob (*, ? and [...]) matched against a
+// whole file name into an anchored regular expression.
+func GlobPattern(glob string) string {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+
+	inClass := false
+	classStart := false
+
+	for _, char := range glob {
+		switch {
+		case classStart && char == '!':
+			classStart = false
+			pattern.WriteRune('^')
+		case inClass:
+			classStart = false
+			if char == ']' {
+				inClass = false
+			}
+			if char == '\\' {
+				pattern.WriteString(`\\`)
+				continue
+			}
+			pattern.WriteRune(char)
+		case char == '*':
+			pattern.WriteString(".*")
+		case char == '?':
+			pattern.WriteString(".")
+		case char == '[':
+			inClass = true
+			classStart = true
+			pattern.WriteRune(char)
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(char)))
+		}
+	}
+
+	if inClass {
+		// an unterminated class is matched literally, like path.Match refuses it.
+		return "^" + regexp.QuoteMeta(glob) + "$"
+	}
+
+	pattern.WriteString("$")
+
+	return pattern.String()
+}
+
+type ListOptions struct {
+	Sort       SortField
+	Descending bool
+	Limit      int64
+	Cursor     string
+}
+
+type Page struct {
+	Files      []models.FileMetadata
+	NextCursor string
+}
+
+type cursor struct {
+	Value json.RawMessage `json:"v"`
+	ID    string          `json:"id"`
+}
+
+// Find returns a single page of the files matching the query. Pages are
+// keyset paginated on the sort field and the id, so the cursor stays valid
+// while files are added or removed.
+func (c *Catalog) Find(ctx context.Context, query Query, opts ListOptions) (*Page, error) {
+	if !opts.Sort.Valid() {
+		opts.Sort = SortName
+	}
+
+	limit := opts.Limit
+	if limit <= 0 || limit > MaxLimit {
+		limit = DefaultLimit
+	}
+
+	key := opts.Sort.key()
+	direction := 1
+	if opts.Descending {
+		direction = -1
+	}
+
+	filter := query.Filter()
+
+	if opts.Cursor != "" {
+		after, err := decodeCursor(opts.Cursor, opts.Sort)
+		if err != nil {
+			return nil, err
+		}
+
+		filter = bson.D{{Key: "$and", Value: bson.A{filter, after.filter(key, direction)}}}
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: key, Value: direction}, {Key: FieldID, Value: direction}}).
+		SetLimit(limit + 1)
+
+	cur, err := c.files.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []models.FileMetadata
+	if err = cur.All(ctx, &files); err != nil {
+		return nil, err
+	}
+
+	page := &Page{Files: files}
+
+	if int64(len(files)) > limit {
+		page.Files = files[:limit]
+
+		page.NextCursor, err = encodeCursor(page.Files[limit-1], opts.Sort)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return page, nil
+}
+
+type position struct {
+	value interface{}
+	id    primitive.ObjectID
+}
+
+func (p position) filter(key string, direction int) bson.M {
+	op := "$gt"
+	if direction < 0 {
+		op = "$lt"
+	}
+
+	return bson.M{"$or": bson.A{
+		bson.M{key: bson.M{op: p.value}},
+		bson.M{key: p.value, FieldID: bson.M{op: p.id}},
+	}}
+}
+
+func encodeCursor(file models.FileMetadata, sort SortField) (string, error) {
+	var value interface{} = file.FileName
+
+	switch sort {
+	case SortSize:
+		value = file.FileSize
+	case SortCreated:
+		value = file.CreationTime
+	case SortName:
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	encoded, err := json.Marshal(cursor{Value: raw, ID: file.Id.Hex()})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+func decodeCursor(encoded string, sort SortField) (*position, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var decoded cursor
+	if err = json.Unmarshal(raw, &decoded); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	id, err := primitive.ObjectIDFromHex(decoded.ID)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	pos := &position{id: id}
+
+	switch sort {
+	case SortSize, SortCreated:
+		var number int64
+		err = json.Unmarshal(decoded.Value, &number)
+		pos.value = number
+	case SortName:
+		var name string
+		err = json.Unmarshal(decoded.Value, &name)
+		pos.value = name
+	}
+
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return pos, nil
+}
+
+// Names returns the names in dir matching pattern.
+func (c *Catalog) Names(ctx context.Context, dir string, pattern string) ([]string, error) {
+	filter := bson.D{
+		{Key: FieldPath, Value: dir},
+		{Key: FieldName, Value: primitive.Regex{Pattern: pattern}},
+	}
+
+	cur, err := c.files.Find(ctx, filter, options.Find().SetProjection(bson.M{FieldName: 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	var files []struct {
+		Name string `bson:"name"`
+	}
+	if err = cur.All(ctx, &files); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+
+	return names, nil
+}
@@ -0,0 +1,68 @@
+package catalog_test
+
+import (
+	"regexp"
+	"testing"
+
+	"dss-main/catalog"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func Test_queryFilter(t *testing.T) {
+	processing := true
+
+	filter := catalog.Query{
+		Path:       "/docs",
+		Kind:       catalog.KindFile,
+		Processing: &processing,
+	}.Filter()
+
+	require.Equal(t, bson.D{
+		{Key: catalog.FieldName, Value: bson.M{"$ne": "/"}},
+		{Key: catalog.FieldPath, Value: "/docs"},
+		{Key: catalog.FieldIsDirectory, Value: false},
+		{Key: catalog.FieldIsHidden, Value: true},
+	}, filter)
+}
+
+func Test_emptyQueryFilter(t *testing.T) {
+	require.Equal(t, bson.D{
+		{Key: catalog.FieldName, Value: bson.M{"$ne": "/"}},
+	}, catalog.Query{}.Filter())
+}
+
+func Test_globPattern(t *testing.T) {
+	tests := []struct {
+		glob    string
+		matches []string
+		misses  []string
+	}{
+		{glob: "*.pdf", matches: []string{"a.pdf", ".pdf"}, misses: []string{"a.pdf.zip", "apdf"}},
+		{glob: "report-?.txt", matches: []string{"report-1.txt"}, misses: []string{"report-10.txt"}},
+		{glob: "[ab]*", matches: []string{"alpha", "beta"}, misses: []string{"gamma"}},
+		{glob: "[!ab]*", matches: []string{"gamma"}, misses: []string{"alpha"}},
+		{glob: "a+b(1)", matches: []string{"a+b(1)"}, misses: []string{"aab1"}},
+		{glob: "[abc", matches: []string{"[abc"}, misses: []string{"a"}},
+	}
+
+	for _, test := range tests {
+		pattern := regexp.MustCompile(catalog.GlobPattern(test.glob))
+
+		for _, name := range test.matches {
+			require.Truef(t, pattern.MatchString(name), "%s should match %s", test.glob, name)
+		}
+
+		for _, name := range test.misses {
+			require.Falsef(t, pattern.MatchString(name), "%s should not match %s", test.glob, name)
+		}
+	}
+}
+
+func Test_textQueryFilter(t *testing.T) {
+	require.Equal(t, bson.D{
+		{Key: catalog.FieldName, Value: bson.M{"$ne": "/"}},
+		{Key: "$text", Value: bson.M{"$search": `"Q3" "report"`}},
+	}, catalog.Query{Text: ` Q3 "report `}.Filter())
+}
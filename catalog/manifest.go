@@ -0,0 +1,57 @@
+package catalog
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// FieldChecksum holds the hex encoded sha256 of the content of a file,
+	// it is set once the whole content was published.
+	FieldChecksum = "sha256"
+	// FieldModTime holds the modification time of a file in unix seconds,
+	// as reported by the uploader or the time of the upload.
+	FieldModTime = "mtime"
+)
+
+// ManifestEntry is what a sync needs to know about a file to decide
+// whether its content changed.
+type ManifestEntry struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Name        string             `bson:"name"`
+	Path        string             `bson:"path"`
+	Size        int64              `bson:"size"`
+	IsDirectory bool               `bson:"isDirectory"`
+	IsHidden    bool               `bson:"ishidden"`
+	Checksum    string             `bson:"sha256"`
+	ModTime     int64              `bson:"mtime"`
+}
+
+// Manifest returns every file under dir, ordered so that parents come
+// before their children. The fragments are left out so large trees stay
+// cheap to read.
+func (c *Catalog) Manifest(ctx context.Context, dir string) ([]ManifestEntry, error) {
+	filter := bson.D{
+		{Key: FieldPath, Value: bson.M{"$regex": SubtreePattern(dir, 0)}},
+		{Key: FieldName, Value: bson.M{"$ne": "/"}},
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: FieldPath, Value: 1}, {Key: FieldName, Value: 1}}).
+		SetProjection(bson.M{FieldFragments: 0, FieldTags: 0})
+
+	cur, err := c.files.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []ManifestEntry{}
+	if err = cur.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
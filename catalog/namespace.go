@@ -0,0 +1,104 @@
+package catalog
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IsNameTaken reports whether a write failed on the unique (path, name) index.
+func IsNameTaken(err error) bool {
+	return mongo.IsDuplicateKeyError(err)
+}
+
+// Relocate sets the path and name of a file in a single update, so the
+// unique index never sees a half moved file.
+func (c *Catalog) Relocate(ctx context.Context, id primitive.ObjectID, path string, name string) error {
+	update := bson.M{"$set": bson.M{FieldPath: path, FieldName: name}}
+
+	_, err := c.files.UpdateOne(ctx, bson.D{{Key: FieldID, Value: id}}, update)
+	return err
+}
+
+// MoveSubtree rewrites the path of everything under oldDir to be under newDir.
+func (c *Catalog) MoveSubtree(ctx context.Context, oldDir string, newDir string) error {
+	oldDir = strings.TrimSuffix(oldDir, "/")
+
+	filter := bson.D{
+		{Key: FieldPath, Value: bson.M{"$regex": SubtreePattern(oldDir, 0)}},
+		{Key: FieldName, Value: bson.M{"$ne": "/"}},
+	}
+
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			FieldPath: bson.M{"$concat": bson.A{
+				strings.TrimSuffix(newDir, "/"),
+				bson.M{"$substrCP": bson.A{"$" + FieldPath, utf8.RuneCountInString(oldDir), 1 << 30}},
+			}},
+		}}},
+	}
+
+	_, err := c.files.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// HasChildren reports whether anything is stored directly under dir.
+func (c *Catalog) HasChildren(ctx context.Context, dir string) (bool, error) {
+	filter := bson.D{
+		{Key: FieldPath, Value: dir},
+		{Key: FieldName, Value: bson.M{"$ne": "/"}},
+	}
+
+	count, err := c.files.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// DeleteSubtree deletes everything under dir along with the archived
+// versions of the deleted files.
+func (c *Catalog) DeleteSubtree(ctx context.Context, dir string) (int64, error) {
+	filter := bson.D{
+		{Key: FieldPath, Value: bson.M{"$regex": SubtreePattern(dir, 0)}},
+		{Key: FieldName, Value: bson.M{"$ne": "/"}},
+	}
+
+	cur, err := c.files.Find(ctx, filter, options.Find().SetProjection(bson.M{FieldID: 1}))
+	if err != nil {
+		return 0, err
+	}
+
+	var files []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err = cur.All(ctx, &files); err != nil {
+		return 0, err
+	}
+
+	if len(files) == 0 {
+		return 0, nil
+	}
+
+	ids := make(bson.A, 0, len(files))
+	for _, file := range files {
+		ids = append(ids, file.ID)
+	}
+
+	if _, err = c.versions.DeleteMany(ctx, bson.M{"fileId": bson.M{"$in": ids}}); err != nil {
+		return 0, err
+	}
+
+	result, err := c.files.DeleteMany(ctx, bson.M{FieldID: bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
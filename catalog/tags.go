@@ -0,0 +1,74 @@
+package catalog
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type TagCount struct {
+	Tag   string `bson:"_id" json:"tag"`
+	Count int64  `bson:"count" json:"count"`
+}
+
+func (c *Catalog) AddTags(ctx context.Context, id string, tags []string) error {
+	return c.updateByID(ctx, id, bson.M{"$addToSet": bson.M{FieldTags: bson.M{"$each": tags}}})
+}
+
+func (c *Catalog) RemoveTags(ctx context.Context, id string, tags []string) error {
+	return c.updateByID(ctx, id, bson.M{"$pullAll": bson.M{FieldTags: tags}})
+}
+
+// TagSubtree adds or removes tags from every file under dir and returns how
+// many files were changed.
+func (c *Catalog) TagSubtree(ctx context.Context, dir string, tags []string, remove bool) (int64, error) {
+	update := bson.M{"$addToSet": bson.M{FieldTags: bson.M{"$each": tags}}}
+	if remove {
+		update = bson.M{"$pullAll": bson.M{FieldTags: tags}}
+	}
+
+	filter := bson.D{
+		{Key: FieldPath, Value: bson.M{"$regex": SubtreePattern(dir, 0)}},
+		{Key: FieldName, Value: bson.M{"$ne": "/"}},
+	}
+
+	result, err := c.files.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+// TagCounts returns every tag in use along with the number of files
+// carrying it, most used first.
+func (c *Catalog) TagCounts(ctx context.Context) ([]TagCount, error) {
+	pipeline := bson.A{
+		bson.M{"$unwind": "$" + FieldTags},
+		bson.M{"$group": bson.M{"_id": "$" + FieldTags, "count": bson.M{"$sum": 1}}},
+		bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+	}
+
+	cur, err := c.files.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := []TagCount{}
+	if err = cur.All(ctx, &counts); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+func (c *Catalog) updateByID(ctx context.Context, id string, update interface{}) error {
+	hex, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.files.UpdateOne(ctx, bson.D{{Key: FieldID, Value: hex}}, update)
+	return err
+}
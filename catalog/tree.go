@@ -0,0 +1,179 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yakiroren/dss-common/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Usage is the aggregated size of a single entry of a directory, for
+// directories it covers everything under them.
+type Usage struct {
+	Name        string `bson:"_id"`
+	IsDirectory bool   `bson:"directory"`
+	Bytes       int64  `bson:"bytes"`
+	Files       int64  `bson:"files"`
+	Directories int64  `bson:"directories"`
+	Fragments   int64  `bson:"fragments"`
+}
+
+// SubtreePattern matches the path of every file under dir that is at most
+// depth levels deep, a depth of zero matches the whole subtree.
+func SubtreePattern(dir string, depth int) string {
+	dir = strings.TrimSuffix(dir, "/")
+	quoted := regexp.QuoteMeta(dir)
+
+	if depth <= 0 {
+		return fmt.Sprintf("^%s(/|$)", quoted)
+	}
+
+	if dir == "" {
+		// children of the root are stored under "/" rather than "".
+		if depth == 1 {
+			return "^/$"
+		}
+		return fmt.Sprintf("^/([^/]+(/[^/]+){0,%d})?$", depth-2)
+	}
+
+	return fmt.Sprintf("^%s(/[^/]+){0,%d}$", quoted, depth-1)
+}
+
+// Subtree returns every file under dir up to the given depth, ordered so
+// that parents come before their children.
+func (c *Catalog) Subtree(ctx context.Context, dir string, depth int) ([]models.FileMetadata, error) {
+	filter := bson.D{
+		{Key: FieldPath, Value: bson.M{"$regex": SubtreePattern(dir, depth)}},
+		{Key: FieldName, Value: bson.M{"$ne": "/"}},
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: FieldPath, Value: 1}, {Key: FieldName, Value: 1}})
+
+	cur, err := c.files.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []models.FileMetadata
+	if err = cur.All(ctx, &files); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// keyField holds the path relative to the listed directory while Objects sorts
+// on it, it is never stored.
+const keyField = "key"
+
+// Objects returns a page of the files under dir ordered by their path relative
+// to dir, which is how object stores order their keys. Only keys starting
+// with prefix and not before from are returned, so the next page starts
+// right after the last key of the previous one. Directories are left out.
+func (c *Catalog) Objects(ctx context.Context, dir string, prefix string, from string, limit int64,
+) ([]models.FileMetadata, error) {
+	dir = strings.TrimSuffix(dir, "/")
+
+	// only the directories the prefix can be in are matched on the path.
+	matched := dir
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		matched = dir + "/" + prefix[:i]
+	}
+
+	fullPath := bson.M{"$cond": bson.A{
+		bson.M{"$eq": bson.A{"$" + FieldPath, "/"}},
+		bson.M{"$concat": bson.A{"/", "$" + FieldName}},
+		bson.M{"$concat": bson.A{"$" + FieldPath, "/", "$" + FieldName}},
+	}}
+
+	key := bson.M{keyField: bson.M{"$gte": from}}
+	if prefix != "" {
+		key = bson.M{"$and": bson.A{key, bson.M{keyField: bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}}}}
+	}
+
+	pipeline := bson.A{
+		bson.M{"$match": bson.D{
+			{Key: FieldPath, Value: bson.M{"$regex": SubtreePattern(matched, 0)}},
+			{Key: FieldIsDirectory, Value: false},
+		}},
+		bson.M{"$addFields": bson.M{
+			keyField: bson.M{"$substrCP": bson.A{fullPath, utf8.RuneCountInString(dir) + 1, 1 << 30}},
+		}},
+		bson.M{"$match": key},
+		bson.M{"$sort": bson.M{keyField: 1}},
+		bson.M{"$limit": limit},
+	}
+
+	cur, err := c.files.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []models.FileMetadata
+	if err = cur.All(ctx, &files); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// Usage aggregates the size, file count and fragment count of every entry
+// of dir in a single pass over its subtree.
+func (c *Catalog) Usage(ctx context.Context, dir string) ([]Usage, error) {
+	dir = strings.TrimSuffix(dir, "/")
+	prefix := dir + "/"
+	if dir == "" {
+		dir = "/"
+	}
+
+	isDirectory := "$" + FieldIsDirectory
+	isChild := bson.M{"$eq": bson.A{"$" + FieldPath, dir}}
+
+	pipeline := bson.A{
+		bson.M{"$match": bson.D{
+			{Key: FieldPath, Value: bson.M{"$regex": SubtreePattern(dir, 0)}},
+			{Key: FieldName, Value: bson.M{"$ne": "/"}},
+		}},
+		bson.M{"$addFields": bson.M{
+			"child": bson.M{"$cond": bson.A{
+				isChild,
+				"$" + FieldName,
+				bson.M{"$arrayElemAt": bson.A{
+					bson.M{"$split": bson.A{
+						bson.M{"$substrCP": bson.A{"$" + FieldPath, utf8.RuneCountInString(prefix), 1 << 30}},
+						"/",
+					}},
+					0,
+				}},
+			}},
+		}},
+		bson.M{"$group": bson.M{
+			"_id":         "$child",
+			"directory":   bson.M{"$max": bson.M{"$and": bson.A{isChild, isDirectory}}},
+			"bytes":       bson.M{"$sum": bson.M{"$cond": bson.A{isDirectory, 0, "$" + FieldSize}}},
+			"files":       bson.M{"$sum": bson.M{"$cond": bson.A{isDirectory, 0, 1}}},
+			"directories": bson.M{"$sum": bson.M{"$cond": bson.A{isDirectory, 1, 0}}},
+			"fragments": bson.M{"$sum": bson.M{"$size": bson.M{
+				"$ifNull": bson.A{"$" + FieldFragments, bson.A{}},
+			}}},
+		}},
+		bson.M{"$sort": bson.M{"_id": 1}},
+	}
+
+	cur, err := c.files.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var usage []Usage
+	if err = cur.All(ctx, &usage); err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
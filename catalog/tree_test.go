@@ -0,0 +1,38 @@
+package catalog_test
+
+import (
+	"regexp"
+	"testing"
+
+	"dss-main/catalog"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_subtreePattern(t *testing.T) {
+	tests := []struct {
+		dir     string
+		depth   int
+		matches []string
+		misses  []string
+	}{
+		{dir: "/", depth: 0, matches: []string{"/", "/a", "/a/b/c"}},
+		{dir: "/", depth: 1, matches: []string{"/"}, misses: []string{"/a"}},
+		{dir: "/", depth: 2, matches: []string{"/", "/a"}, misses: []string{"/a/b"}},
+		{dir: "/a", depth: 0, matches: []string{"/a", "/a/b/c"}, misses: []string{"/ab", "/", "/b/a"}},
+		{dir: "/a", depth: 2, matches: []string{"/a", "/a/b"}, misses: []string{"/a/b/c", "/ab"}},
+		{dir: "/a.b/", depth: 1, matches: []string{"/a.b"}, misses: []string{"/axb", "/a.b/c"}},
+	}
+
+	for _, test := range tests {
+		pattern := regexp.MustCompile(catalog.SubtreePattern(test.dir, test.depth))
+
+		for _, path := range test.matches {
+			require.Truef(t, pattern.MatchString(path), "%s depth %d should match %s", test.dir, test.depth, path)
+		}
+
+		for _, path := range test.misses {
+			require.Falsef(t, pattern.MatchString(path), "%s depth %d should not match %s", test.dir, test.depth, path)
+		}
+	}
+}
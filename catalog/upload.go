@@ -0,0 +1,42 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FieldUploadError holds why the content of a file could not be stored, it
+// is dropped when the file gets new content.
+const FieldUploadError = "uploadError"
+
+// SetUploadError marks the upload of a file as failed.
+func (c *Catalog) SetUploadError(ctx context.Context, id string, message string) error {
+	return c.updateByID(ctx, id, bson.M{"$set": bson.M{FieldUploadError: message}})
+}
+
+// UploadError returns why the last upload of a file failed, it is empty
+// when the upload didn't fail.
+func (c *Catalog) UploadError(ctx context.Context, id string) (string, error) {
+	hex, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return "", err
+	}
+
+	var fields struct {
+		UploadError string `bson:"uploadError"`
+	}
+
+	projection := options.FindOne().SetProjection(bson.M{FieldUploadError: 1})
+
+	err = c.files.FindOne(ctx, bson.D{{Key: FieldID, Value: hex}}, projection).Decode(&fields)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", nil
+	}
+
+	return fields.UploadError, err
+}
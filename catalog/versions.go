@@ -0,0 +1,228 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/yakiroren/dss-common/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// FieldVersion holds the version number of the current content of a
+	// file, files that were never versioned don't have it and are version 1.
+	FieldVersion = "version"
+	// FieldVersioning marks directories whose files keep their old versions.
+	FieldVersioning = "versioning"
+
+	versionsSuffix = "_versions"
+)
+
+var ErrVersionNotFound = errors.New("version not found")
+
+// Version is an archived copy of the metadata of a file, its fragments
+// are left untouched so the content can still be read.
+type Version struct {
+	ID         primitive.ObjectID  `bson:"_id"`
+	FileID     primitive.ObjectID  `bson:"fileId"`
+	Version    int                 `bson:"version"`
+	ArchivedAt int64               `bson:"archivedAt"`
+	File       models.FileMetadata `bson:"file"`
+	// Checksum and ModTime are kept apart from File, the model doesn't
+	// carry them.
+	Checksum string `bson:"sha256,omitempty"`
+	ModTime  int64  `bson:"mtime,omitempty"`
+}
+
+type versionFields struct {
+	Version    int    `bson:"version"`
+	Versioning bool   `bson:"versioning"`
+	Checksum   string `bson:"sha256"`
+	ModTime    int64  `bson:"mtime"`
+}
+
+func (c *Catalog) createVersionIndexes(ctx context.Context) error {
+	_, err := c.versions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "fileId", Value: 1}, {Key: FieldVersion, Value: -1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func (c *Catalog) versionFields(ctx context.Context, filter bson.D) (*versionFields, error) {
+	fields := &versionFields{}
+
+	projection := options.FindOne().SetProjection(bson.M{
+		FieldVersion: 1, FieldVersioning: 1, FieldChecksum: 1, FieldModTime: 1,
+	})
+	if err := c.files.FindOne(ctx, filter, projection).Decode(fields); err != nil {
+		return nil, err
+	}
+
+	if fields.Version == 0 {
+		fields.Version = 1
+	}
+
+	return fields, nil
+}
+
+// CurrentVersion returns the version number of the current content of a file.
+func (c *Catalog) CurrentVersion(ctx context.Context, id primitive.ObjectID) (int, error) {
+	fields, err := c.versionFields(ctx, bson.D{{Key: FieldID, Value: id}})
+	if err != nil {
+		return 0, err
+	}
+
+	return fields.Version, nil
+}
+
+// Versioning reports whether uploads into dir keep the old versions of files.
+func (c *Catalog) Versioning(ctx context.Context, dir string) bool {
+	filter := bson.D{{Key: FieldPath, Value: filepath.Dir(dir)}, {Key: FieldName, Value: filepath.Base(dir)}}
+
+	fields, err := c.versionFields(ctx, filter)
+	if err != nil {
+		return false
+	}
+
+	return fields.Versioning
+}
+
+func (c *Catalog) SetVersioning(ctx context.Context, id string, enabled bool) error {
+	return c.updateByID(ctx, id, bson.M{"$set": bson.M{FieldVersioning: enabled}})
+}
+
+// Supersede archives the current content of file and points the file at
+// content as its next version, in a single transaction so the file never
+// ends up without content or with two current versions. The file keeps its
+// id so that the fragments published for it keep landing on the same
+// document. checksum and modTime describe content, they are left unset when
+// empty. The new version number is returned.
+func (c *Catalog) Supersede(ctx context.Context, file models.FileMetadata, content models.FileMetadata,
+	checksum string, modTime int64,
+) (int, error) {
+	var next int
+
+	err := c.WithTransaction(ctx, func(ctx context.Context) error {
+		version, err := c.archive(ctx, file)
+		if err != nil {
+			return err
+		}
+
+		next = version + 1
+
+		return c.replace(ctx, file.Id, content, next, checksum, modTime)
+	})
+
+	return next, err
+}
+
+// archive stores the current content of file as an old version.
+func (c *Catalog) archive(ctx context.Context, file models.FileMetadata) (int, error) {
+	fields, err := c.versionFields(ctx, bson.D{{Key: FieldID, Value: file.Id}})
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = c.versions.InsertOne(ctx, Version{
+		ID:         primitive.NewObjectID(),
+		FileID:     file.Id,
+		Version:    fields.Version,
+		ArchivedAt: time.Now().Unix(),
+		File:       file,
+		Checksum:   fields.Checksum,
+		ModTime:    fields.ModTime,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return fields.Version, nil
+}
+
+// replace points the file at new content, the checksum, modification time
+// and upload error of the old content are dropped.
+func (c *Catalog) replace(ctx context.Context, id primitive.ObjectID, content models.FileMetadata, version int,
+	checksum string, modTime int64,
+) error {
+	set := bson.M{
+		FieldSize:           content.FileSize,
+		FieldCurrentSize:    content.CurrentSize,
+		FieldCreationTime:   content.CreationTime,
+		FieldFragments:      content.Fragments,
+		FieldTotalFragments: content.TotalFragments,
+		FieldIsHidden:       content.IsHidden,
+		FieldVersion:        version,
+	}
+	unset := bson.M{FieldUploadError: ""}
+
+	if checksum != "" {
+		set[FieldChecksum] = checksum
+	} else {
+		unset[FieldChecksum] = ""
+	}
+
+	if modTime != 0 {
+		set[FieldModTime] = modTime
+	} else {
+		unset[FieldModTime] = ""
+	}
+
+	update := bson.M{"$set": set, "$unset": unset}
+
+	_, err := c.files.UpdateOne(ctx, bson.D{{Key: FieldID, Value: id}}, update)
+	return err
+}
+
+// Versions returns the archived versions of a file, newest first.
+func (c *Catalog) Versions(ctx context.Context, id primitive.ObjectID) ([]Version, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: FieldVersion, Value: -1}})
+
+	cur, err := c.versions.Find(ctx, bson.D{{Key: "fileId", Value: id}}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []Version{}
+	if err = cur.All(ctx, &versions); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+func (c *Catalog) Version(ctx context.Context, id primitive.ObjectID, version int) (*Version, error) {
+	output := &Version{}
+
+	filter := bson.D{{Key: "fileId", Value: id}, {Key: FieldVersion, Value: version}}
+
+	err := c.versions.FindOne(ctx, filter).Decode(output)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrVersionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// DeleteVersions removes archived versions, either the given ones or all the
+// versions of a file when no version is given.
+func (c *Catalog) DeleteVersions(ctx context.Context, id primitive.ObjectID, versions ...int) (int64, error) {
+	filter := bson.D{{Key: "fileId", Value: id}}
+	if len(versions) > 0 {
+		filter = append(filter, bson.E{Key: FieldVersion, Value: bson.M{"$in": versions}})
+	}
+
+	result, err := c.versions.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
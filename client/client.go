@@ -0,0 +1,177 @@
+// Package client is a Go client of the dss REST api.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	apiPrefix = "/api/v1"
+	// defaultPollInterval is how often WaitForUpload and WaitForJob check on
+	// the server.
+	defaultPollInterval = time.Second
+)
+
+// Client calls the api of a dss server, it is safe for concurrent use.
+type Client struct {
+	baseURL      *url.URL
+	httpClient   *http.Client
+	pollInterval time.Duration
+	token        string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sends the requests with httpClient instead of
+// http.DefaultClient.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithPollInterval sets how often the Wait methods poll the server.
+func WithPollInterval(interval time.Duration) Option {
+	return func(c *Client) {
+		c.pollInterval = interval
+	}
+}
+
+// WithToken authenticates the requests with an api key or a jwt.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// New returns a client of the server at baseURL, like http://localhost:8080.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if parsed.Scheme != "http" && parsed.Scheme != "https" || parsed.Host == "" {
+		return nil, fmt.Errorf("the base url must be an absolute http or https url, got %q", baseURL)
+	}
+
+	c := &Client{baseURL: parsed, httpClient: http.DefaultClient, pollInterval: defaultPollInterval}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+// url returns the url of an api endpoint, the segments are escaped so they
+// can hold any file name.
+func (c *Client) url(endpoint string, query url.Values) string {
+	target := *c.baseURL
+	target.Path = path.Join("/", c.baseURL.Path, endpoint)
+	target.RawPath = ""
+	target.RawQuery = ""
+
+	if len(query) > 0 {
+		target.RawQuery = query.Encode()
+	}
+
+	return target.String()
+}
+
+// apiPath joins an api route and a path of the namespace.
+func apiPath(route string, namespacePath string) string {
+	return apiPrefix + route + "/" + strings.TrimPrefix(namespacePath, "/")
+}
+
+// roundTrip sends a request with the credentials of the client.
+func (c *Client) roundTrip(request *http.Request) (*http.Response, error) {
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	return c.httpClient.Do(request)
+}
+
+// do sends a request and turns error responses into an *Error.
+func (c *Client) do(request *http.Request) (*http.Response, error) {
+	response, err := c.roundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode >= http.StatusBadRequest {
+		defer closeBody(response)
+		return nil, newError(response)
+	}
+
+	return response, nil
+}
+
+func (c *Client) send(ctx context.Context, method string, endpoint string, query url.Values, body io.Reader,
+	contentType string,
+) (*http.Response, error) {
+	if body == nil {
+		body = http.NoBody
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, c.url(endpoint, query), body)
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+
+	return c.do(request)
+}
+
+// sendForm sends form as an url encoded body.
+func (c *Client) sendForm(ctx context.Context, method string, endpoint string, form url.Values,
+) (*http.Response, error) {
+	return c.send(ctx, method, endpoint, nil, strings.NewReader(form.Encode()),
+		"application/x-www-form-urlencoded")
+}
+
+// decode reads a json response into out and closes it.
+func decode(response *http.Response, out interface{}) error {
+	defer closeBody(response)
+
+	if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+		return fmt.Errorf("the response of the server is not valid: %w", err)
+	}
+
+	return nil
+}
+
+// readText reads a plain text response, like the id of an upload.
+func readText(response *http.Response) (string, error) {
+	defer closeBody(response)
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(body)), nil
+}
+
+func closeBody(response *http.Response) {
+	_, _ = io.Copy(io.Discard, response.Body)
+	_ = response.Body.Close()
+}
+
+func formBool(form url.Values, key string, value bool) {
+	if value {
+		form.Set(key, "true")
+	}
+}
@@ -0,0 +1,166 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"dss-main/client"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newClient(t *testing.T, handler http.HandlerFunc) *client.Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	c, err := client.New(server.URL, client.WithPollInterval(time.Millisecond))
+	require.NoError(t, err)
+
+	return c
+}
+
+func Test_errors(t *testing.T) {
+	c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"code":"not_found","message":"file not found","request_id":"42"}`))
+	})
+
+	_, err := c.Status(context.Background(), "64b000000000000000000000")
+	require.ErrorIs(t, err, client.ErrNotFound)
+
+	var apiErr *client.Error
+	require.True(t, errors.As(err, &apiErr))
+	require.Equal(t, "not_found", apiErr.Code)
+	require.Equal(t, "file not found", apiErr.Message)
+	require.Equal(t, "42", apiErr.RequestID)
+
+	_, err = client.New("localhost:8080")
+	require.Error(t, err)
+}
+
+func Test_upload(t *testing.T) {
+	content := strings.Repeat("fragment", 1000)
+
+	c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPut, r.Method)
+		require.Equal(t, "/api/v1/upload/photos/a b#1.txt", r.URL.Path)
+		require.Equal(t, []string{"x", "y"}, r.URL.Query()["tags"])
+		require.Equal(t, "true", r.URL.Query().Get("parents"))
+		require.Equal(t, "1700000000", r.URL.Query().Get("mtime"))
+		require.Equal(t, int64(len(content)), r.ContentLength)
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Equal(t, content, string(body))
+
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, "64b000000000000000000001")
+	})
+
+	var sent int64
+
+	id, err := c.Upload(context.Background(), "/photos/a b#1.txt", strings.NewReader(content), int64(len(content)),
+		&client.UploadOptions{
+			Tags:     []string{"x", "y"},
+			Parents:  true,
+			ModTime:  time.Unix(1700000000, 0),
+			Progress: func(n int64) { sent = n },
+		})
+	require.NoError(t, err)
+	require.Equal(t, "64b000000000000000000001", id)
+	require.Equal(t, int64(len(content)), sent)
+}
+
+func Test_downloadRange(t *testing.T) {
+	c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v1/download/id", r.URL.Path)
+
+		switch r.Header.Get("Range") {
+		case "bytes=5-":
+			w.WriteHeader(http.StatusPartialContent)
+			fmt.Fprint(w, "world")
+		case "bytes=0-4":
+			w.WriteHeader(http.StatusPartialContent)
+			fmt.Fprint(w, "hello")
+		case "":
+			fmt.Fprint(w, "helloworld")
+		default:
+			http.Error(w, "the range is outside of the file", http.StatusRequestedRangeNotSatisfiable)
+		}
+	})
+
+	read := func(offset int64, length int64) (string, error) {
+		body, err := c.Download(context.Background(), "id", offset, length)
+		if err != nil {
+			return "", err
+		}
+		defer body.Close()
+
+		content, err := io.ReadAll(body)
+
+		return string(content), err
+	}
+
+	content, err := read(0, 0)
+	require.NoError(t, err)
+	require.Equal(t, "helloworld", content)
+
+	content, err = read(5, 0)
+	require.NoError(t, err)
+	require.Equal(t, "world", content)
+
+	content, err = read(0, 5)
+	require.NoError(t, err)
+	require.Equal(t, "hello", content)
+
+	_, err = read(20, 0)
+	require.ErrorIs(t, err, client.ErrRangeUnavailable)
+}
+
+func Test_waitForUpload(t *testing.T) {
+	polls := 0
+
+	c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		polls++
+
+		if polls < 3 {
+			fmt.Fprint(w, `{"State":"in progress","TotalFragments":null,"UploadedFragments":1}`)
+			return
+		}
+
+		fmt.Fprint(w, `{"State":"done","TotalFragments":3,"UploadedFragments":3}`)
+	})
+
+	status, err := c.WaitForUpload(context.Background(), "id")
+	require.NoError(t, err)
+	require.Equal(t, client.StateDone, status.State)
+	require.Equal(t, 3, *status.TotalFragments)
+	require.Equal(t, 3, polls)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	polls = 0
+	_, err = c.WaitForUpload(ctx, "id")
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func Test_waitForFailedUpload(t *testing.T) {
+	c := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"State":"failed","TotalFragments":null,"UploadedFragments":2,"Error":"could not reach the url"}`)
+	})
+
+	status, err := c.WaitForUpload(context.Background(), "id")
+	require.ErrorContains(t, err, "could not reach the url")
+	require.Equal(t, client.StateFailed, status.State)
+}
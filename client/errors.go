@@ -0,0 +1,90 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxErrorBody bounds how much of an error response is read.
+const maxErrorBody = 4096
+
+// the kinds of errors of the api, an *Error matches one of them with
+// errors.Is.
+var (
+	ErrInvalid          = errors.New("the request is not valid")
+	ErrUnauthorized     = errors.New("the credentials are missing or not valid")
+	ErrForbidden        = errors.New("the credentials don't allow the request")
+	ErrNotFound         = errors.New("not found")
+	ErrConflict         = errors.New("conflicts with the current state")
+	ErrTooLarge         = errors.New("the request is too large")
+	ErrRangeUnavailable = errors.New("the range is outside of the file")
+	ErrServer           = errors.New("the server failed")
+)
+
+// Error is an error response of the api. Code is the kind of the error the
+// server reports, like not_found or invalid_path, and is empty when the
+// response wasn't sent by the api.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	RequestID  string
+}
+
+func newError(response *http.Response) *Error {
+	body, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBody))
+
+	apiErr := &Error{StatusCode: response.StatusCode}
+
+	var decoded struct {
+		Code      string `json:"code"`
+		Message   string `json:"message"`
+		RequestID string `json:"request_id"`
+	}
+
+	if json.Unmarshal(body, &decoded) == nil && decoded.Code != "" {
+		apiErr.Code, apiErr.Message, apiErr.RequestID = decoded.Code, decoded.Message, decoded.RequestID
+	} else {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(response.StatusCode)
+	}
+
+	return apiErr
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("dss: %s (%d)", e.Message, e.StatusCode)
+}
+
+// Unwrap returns the kind of the error.
+func (e *Error) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusBadRequest:
+		return ErrInvalid
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict:
+		return ErrConflict
+	case http.StatusRequestEntityTooLarge:
+		return ErrTooLarge
+	case http.StatusRequestedRangeNotSatisfiable:
+		return ErrRangeUnavailable
+	}
+
+	if e.StatusCode >= http.StatusInternalServerError {
+		return ErrServer
+	}
+
+	return nil
+}
@@ -0,0 +1,403 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Download returns the content of a file from offset on, length limits the
+// bytes read and 0 reads to the end. Resuming a download is a Download from
+// the bytes already received.
+func (c *Client) Download(ctx context.Context, id string, offset int64, length int64) (io.ReadCloser, error) {
+	if offset < 0 || length < 0 {
+		return nil, fmt.Errorf("%w: offset and length cant be negative", ErrInvalid)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		c.url(apiPrefix+"/download/"+id, nil), http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case length > 0:
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	case offset > 0:
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// a server that ignored the range sent the whole file.
+	if request.Header.Get("Range") != "" && response.StatusCode != http.StatusPartialContent {
+		closeBody(response)
+		return nil, fmt.Errorf("%w: the server did not honor the range", ErrServer)
+	}
+
+	return response.Body, nil
+}
+
+// Open reads a file by its path, the way a browser downloads it.
+func (c *Client) Open(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	response, err := c.send(ctx, http.MethodGet, "/"+strings.TrimPrefix(filePath, "/"), nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Body, nil
+}
+
+// Archive streams a directory as a zip, or as a tar.gz when format is
+// "tar.gz".
+func (c *Client) Archive(ctx context.Context, dir string, format string) (io.ReadCloser, error) {
+	query := url.Values{}
+	if format != "" {
+		query.Set("format", format)
+	}
+
+	response, err := c.send(ctx, http.MethodGet, apiPath("/archive", dir), query, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Body, nil
+}
+
+// ListOptions pages and orders listings, the zero value lists the first page
+// sorted by name.
+type ListOptions struct {
+	// Type is "file", "dir" or empty for both.
+	Type       string
+	Processing *bool
+	// Sort is one of "name", "size" or "created".
+	Sort       string
+	Descending bool
+	Limit      int
+	// Cursor is the NextCursor of the previous page.
+	Cursor string
+}
+
+func (o *ListOptions) values() url.Values {
+	values := url.Values{}
+	if o == nil {
+		return values
+	}
+
+	setNonEmpty(values, "type", o.Type)
+	setNonEmpty(values, "sort", o.Sort)
+	setNonEmpty(values, "cursor", o.Cursor)
+
+	if o.Processing != nil {
+		values.Set("processing", strconv.FormatBool(*o.Processing))
+	}
+
+	if o.Descending {
+		values.Set("order", "desc")
+	}
+
+	if o.Limit > 0 {
+		values.Set("limit", strconv.Itoa(o.Limit))
+	}
+
+	return values
+}
+
+// Dir lists a page of the entries of a directory.
+func (c *Client) Dir(ctx context.Context, dir string, opts *ListOptions) (*Listing, error) {
+	response, err := c.send(ctx, http.MethodGet, apiPath("/dir", dir), opts.values(), nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	listing := Listing{NextCursor: response.Header.Get("X-Next-Cursor")}
+
+	return &listing, decode(response, &listing.Items)
+}
+
+// DirAll lists every entry of a directory, following the pages.
+func (c *Client) DirAll(ctx context.Context, dir string, opts *ListOptions) ([]File, error) {
+	page := ListOptions{}
+	if opts != nil {
+		page = *opts
+	}
+
+	var files []File
+
+	for {
+		listing, err := c.Dir(ctx, dir, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, listing.Items...)
+
+		if listing.NextCursor == "" {
+			return files, nil
+		}
+
+		page.Cursor = listing.NextCursor
+	}
+}
+
+// Tree returns a directory and its descendants down to depth levels, 0 uses
+// the default depth of the server.
+func (c *Client) Tree(ctx context.Context, dir string, depth int) (*TreeNode, error) {
+	query := url.Values{}
+	if depth > 0 {
+		query.Set("depth", strconv.Itoa(depth))
+	}
+
+	response, err := c.send(ctx, http.MethodGet, apiPath("/tree", dir), query, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var tree TreeNode
+
+	return &tree, decode(response, &tree)
+}
+
+// DiskUsage sums the sizes of the files under a path.
+func (c *Client) DiskUsage(ctx context.Context, filePath string) (*DiskUsage, error) {
+	response, err := c.send(ctx, http.MethodGet, apiPath("/du", filePath), nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var usage DiskUsage
+
+	return &usage, decode(response, &usage)
+}
+
+// Manifest lists every file under a directory with its size, checksum and
+// modification time.
+func (c *Client) Manifest(ctx context.Context, dir string) (*Manifest, error) {
+	response, err := c.send(ctx, http.MethodGet, apiPath("/manifest", dir), nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+
+	return &manifest, decode(response, &manifest)
+}
+
+type SearchOptions struct {
+	ListOptions
+
+	// Query matches names holding every word of it, case insensitively.
+	Query string
+	Glob  string
+	// Extension matches names ending with it, like "jpg".
+	Extension string
+	// Path limits the search to a directory and its descendants.
+	Path string
+	// Tags matches files having all of them.
+	Tags []string
+	// MinSize and MaxSize are in bytes or humanized, like "10MB".
+	MinSize string
+	MaxSize string
+	After   time.Time
+	Before  time.Time
+}
+
+// Search finds files across the namespace.
+func (c *Client) Search(ctx context.Context, opts *SearchOptions) (*Listing, error) {
+	if opts == nil {
+		opts = &SearchOptions{}
+	}
+
+	query := opts.ListOptions.values()
+	setNonEmpty(query, "q", opts.Query)
+	setNonEmpty(query, "glob", opts.Glob)
+	setNonEmpty(query, "ext", opts.Extension)
+	setNonEmpty(query, "path", opts.Path)
+	setNonEmpty(query, "min_size", opts.MinSize)
+	setNonEmpty(query, "max_size", opts.MaxSize)
+
+	for _, tag := range opts.Tags {
+		query.Add("tag", tag)
+	}
+
+	if !opts.After.IsZero() {
+		query.Set("after", strconv.FormatInt(opts.After.Unix(), 10))
+	}
+
+	if !opts.Before.IsZero() {
+		query.Set("before", strconv.FormatInt(opts.Before.Unix(), 10))
+	}
+
+	response, err := c.send(ctx, http.MethodGet, apiPrefix+"/search", query, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var listing Listing
+
+	return &listing, decode(response, &listing)
+}
+
+type MkdirOptions struct {
+	// Parents creates the missing directories and accepts an existing one,
+	// like mkdir -p.
+	Parents    bool
+	Versioning bool
+	Conflict   Conflict
+}
+
+// Mkdir creates the directory name in dir.
+func (c *Client) Mkdir(ctx context.Context, dir string, name string, opts *MkdirOptions) (*File, error) {
+	form := url.Values{"path": {dir}, "name": {name}}
+
+	if opts != nil {
+		formBool(form, "parents", opts.Parents)
+		formBool(form, "versioning", opts.Versioning)
+		setNonEmpty(form, "conflict", string(opts.Conflict))
+	}
+
+	response, err := c.sendForm(ctx, http.MethodPost, apiPrefix+"/mkdir", form)
+	if err != nil {
+		return nil, err
+	}
+
+	var file File
+
+	return &file, decode(response, &file)
+}
+
+// Move moves a file or directory into the directory newPath.
+func (c *Client) Move(ctx context.Context, id string, newPath string, conflict Conflict) error {
+	return c.MoveAs(ctx, id, newPath, "", conflict)
+}
+
+// MoveAs moves a file or directory into the directory newPath and renames
+// it to newName in the same step, an empty newName keeps the name. The
+// conflict policy only applies to the final path and name.
+func (c *Client) MoveAs(ctx context.Context, id string, newPath string, newName string, conflict Conflict) error {
+	form := url.Values{"newpath": {newPath}}
+	setNonEmpty(form, "new_name", newName)
+	setNonEmpty(form, "conflict", string(conflict))
+
+	response, err := c.sendForm(ctx, http.MethodPost, apiPrefix+"/move/"+id, form)
+	if err != nil {
+		return err
+	}
+
+	closeBody(response)
+
+	return nil
+}
+
+func (c *Client) Rename(ctx context.Context, id string, newName string, conflict Conflict) error {
+	form := url.Values{"new_name": {newName}}
+	setNonEmpty(form, "conflict", string(conflict))
+
+	response, err := c.sendForm(ctx, http.MethodPost, apiPrefix+"/rename/"+id, form)
+	if err != nil {
+		return err
+	}
+
+	closeBody(response)
+
+	return nil
+}
+
+type CopyOptions struct {
+	// NewPath is the destination directory, the directory of the source by
+	// default.
+	NewPath string
+	// NewName defaults to the name of the source.
+	NewName  string
+	Conflict Conflict
+}
+
+// Copy duplicates a file or a directory with everything under it, copies
+// share the stored fragments of their source.
+func (c *Client) Copy(ctx context.Context, id string, opts *CopyOptions) (*File, error) {
+	form := url.Values{}
+
+	if opts != nil {
+		setNonEmpty(form, "newpath", opts.NewPath)
+		setNonEmpty(form, "new_name", opts.NewName)
+		setNonEmpty(form, "conflict", string(opts.Conflict))
+	}
+
+	response, err := c.sendForm(ctx, http.MethodPost, apiPrefix+"/copy/"+id, form)
+	if err != nil {
+		return nil, err
+	}
+
+	var file File
+
+	return &file, decode(response, &file)
+}
+
+// Delete removes a file, directories need recursive unless they are empty.
+func (c *Client) Delete(ctx context.Context, id string, recursive bool) error {
+	query := url.Values{}
+	formBool(query, "recursive", recursive)
+
+	response, err := c.send(ctx, http.MethodDelete, apiPrefix+"/delete/"+id, query, nil, "")
+	if err != nil {
+		return err
+	}
+
+	closeBody(response)
+
+	return nil
+}
+
+// Batch runs several operations in one request. A failed atomic batch is
+// returned with Applied unset and the results explaining the failure.
+func (c *Client) Batch(ctx context.Context, batch BatchRequest) (*BatchResponse, error) {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url(apiPrefix+"/batch", nil),
+		bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := c.roundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// the rolled back batch is a conflict that still carries the results.
+	if response.StatusCode == http.StatusConflict &&
+		strings.HasPrefix(response.Header.Get("Content-Type"), "application/json") {
+		var result BatchResponse
+		return &result, decode(response, &result)
+	}
+
+	if response.StatusCode >= http.StatusBadRequest {
+		defer closeBody(response)
+		return nil, newError(response)
+	}
+
+	var result BatchResponse
+
+	return &result, decode(response, &result)
+}
+
+func setNonEmpty(values url.Values, key string, value string) {
+	if value != "" {
+		values.Set(key, value)
+	}
+}
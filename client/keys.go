@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// IssueKey creates an api key, the secret in the result can't be read again.
+// Only admins can manage api keys.
+func (c *Client) IssueKey(ctx context.Context, name string, admin bool) (*APIKey, error) {
+	form := url.Values{"name": {name}}
+	formBool(form, "admin", admin)
+
+	response, err := c.sendForm(ctx, http.MethodPost, apiPrefix+"/keys", form)
+	if err != nil {
+		return nil, err
+	}
+
+	var key APIKey
+
+	return &key, decode(response, &key)
+}
+
+// ListKeys returns every api key, revoked ones included.
+func (c *Client) ListKeys(ctx context.Context) ([]APIKey, error) {
+	response, err := c.send(ctx, http.MethodGet, apiPrefix+"/keys", nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []APIKey
+
+	return keys, decode(response, &keys)
+}
+
+func (c *Client) RevokeKey(ctx context.Context, id string) error {
+	response, err := c.send(ctx, http.MethodDelete, apiPrefix+"/keys/"+id, nil, nil, "")
+	if err != nil {
+		return err
+	}
+
+	closeBody(response)
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+type fileTags struct {
+	ID   string   `json:"id"`
+	Tags []string `json:"tags"`
+}
+
+// AddTags tags a file and returns all of its tags.
+func (c *Client) AddTags(ctx context.Context, id string, tags ...string) ([]string, error) {
+	return c.updateTags(ctx, http.MethodPost, id, tags)
+}
+
+// ReplaceTags sets the tags of a file, no tags clears them.
+func (c *Client) ReplaceTags(ctx context.Context, id string, tags ...string) ([]string, error) {
+	return c.updateTags(ctx, http.MethodPut, id, tags)
+}
+
+func (c *Client) RemoveTags(ctx context.Context, id string, tags ...string) ([]string, error) {
+	return c.updateTags(ctx, http.MethodDelete, id, tags)
+}
+
+func (c *Client) updateTags(ctx context.Context, method string, id string, tags []string) ([]string, error) {
+	// DELETE bodies are often dropped on the way, the server reads the query too.
+	response, err := c.send(ctx, method, apiPrefix+"/tags/"+id, url.Values{"tags": tags}, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var result fileTags
+
+	return result.Tags, decode(response, &result)
+}
+
+// BulkTag adds tags to everything under dir, or removes them with remove,
+// and returns how many files were modified.
+func (c *Client) BulkTag(ctx context.Context, dir string, remove bool, tags ...string) (int64, error) {
+	form := url.Values{"path": {dir}, "tags": tags}
+	if remove {
+		form.Set("op", "remove")
+	}
+
+	response, err := c.sendForm(ctx, http.MethodPost, apiPrefix+"/tags/bulk", form)
+	if err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		Modified int64 `json:"modified"`
+	}
+
+	return result.Modified, decode(response, &result)
+}
+
+// ListTags counts the files of every tag.
+func (c *Client) ListTags(ctx context.Context) ([]TagCount, error) {
+	response, err := c.send(ctx, http.MethodGet, apiPrefix+"/tags", nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var counts []TagCount
+
+	return counts, decode(response, &counts)
+}
@@ -0,0 +1,177 @@
+package client
+
+// the states reported by Status and Job.
+const (
+	StateDone       = "done"
+	StateInProgress = "in progress"
+	StateFailed     = "failed"
+
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Conflict decides what happens when a file is written where another one
+// already exists, the server picks a default per endpoint when it is empty.
+type Conflict string
+
+const (
+	ConflictRename    Conflict = "rename"
+	ConflictOverwrite Conflict = "overwrite"
+	ConflictFail      Conflict = "fail"
+	ConflictSkip      Conflict = "skip"
+)
+
+// File is a file or directory of the namespace.
+type File struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Size         string `json:"size"`
+	Bytes        int64  `json:"bytes"`
+	Created      string `json:"created"`
+	CreationTime int64  `json:"creation_time"`
+	IsDirectory  bool   `json:"directory"`
+	IsProcessing bool   `json:"processing"`
+	// Path is the full path of the file, its name included.
+	Path string `json:"path"`
+}
+
+type Listing struct {
+	Items      []File `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type TreeNode struct {
+	File
+	Children  []*TreeNode `json:"children,omitempty"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+type DiskUsage struct {
+	Path        string      `json:"path"`
+	Size        string      `json:"size"`
+	Bytes       int64       `json:"bytes"`
+	Files       int64       `json:"files"`
+	Directories int64       `json:"directories"`
+	Fragments   int64       `json:"fragments"`
+	IsDirectory bool        `json:"directory"`
+	Children    []DiskUsage `json:"children,omitempty"`
+}
+
+// ManifestEntry is a file under the root of a Manifest, Path is relative to
+// that root. Checksum is the hex sha256 of the content, it is empty when
+// the server doesn't know it.
+type ManifestEntry struct {
+	ID           string `json:"id"`
+	Path         string `json:"path"`
+	Bytes        int64  `json:"bytes"`
+	IsDirectory  bool   `json:"directory"`
+	IsProcessing bool   `json:"processing"`
+	Checksum     string `json:"sha256"`
+	ModTime      int64  `json:"mtime"`
+}
+
+type Manifest struct {
+	Path  string          `json:"path"`
+	Files []ManifestEntry `json:"files"`
+}
+
+type Status struct {
+	State string `json:"State"`
+	// TotalFragments is nil while the length of the upload is unknown.
+	TotalFragments    *int   `json:"TotalFragments"`
+	UploadedFragments int    `json:"UploadedFragments"`
+	Error             string `json:"Error,omitempty"`
+}
+
+// UploadResult is the outcome of one file of a multi file upload.
+type UploadResult struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Error string `json:"error,omitempty"`
+}
+
+type JobEntry struct {
+	Path  string `json:"path"`
+	ID    string `json:"id,omitempty"`
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+// Job tracks a long running request, like extracting an uploaded archive.
+type Job struct {
+	ID       string     `json:"id"`
+	Kind     string     `json:"kind"`
+	State    string     `json:"state"`
+	Error    string     `json:"error,omitempty"`
+	Started  int64      `json:"started"`
+	Finished int64      `json:"finished,omitempty"`
+	Entries  []JobEntry `json:"entries"`
+}
+
+// the operations of a batch.
+const (
+	OpDelete = "delete"
+	OpMove   = "move"
+	OpRename = "rename"
+	OpMkdir  = "mkdir"
+	OpTag    = "tag"
+)
+
+type BatchOperation struct {
+	Op        string   `json:"op"`
+	ID        string   `json:"id,omitempty"`
+	NewPath   string   `json:"newpath,omitempty"`
+	NewName   string   `json:"new_name,omitempty"`
+	Path      string   `json:"path,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Conflict  Conflict `json:"conflict,omitempty"`
+	Parents   bool     `json:"parents,omitempty"`
+	Recursive bool     `json:"recursive,omitempty"`
+}
+
+type BatchRequest struct {
+	// Atomic applies either all of the operations or none of them.
+	Atomic     bool             `json:"atomic"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+type BatchResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	ID     string `json:"id,omitempty"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Applied bool          `json:"applied"`
+	Results []BatchResult `json:"results"`
+}
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+type Version struct {
+	Version      int    `json:"version"`
+	Current      bool   `json:"current"`
+	Size         string `json:"size"`
+	Bytes        int64  `json:"bytes"`
+	CreationTime int64  `json:"creation_time"`
+	ArchivedAt   int64  `json:"archived_at,omitempty"`
+	Fragments    int    `json:"fragments"`
+}
+
+// APIKey is an api key, Key holds its secret only when it was just issued.
+type APIKey struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Admin   bool   `json:"admin"`
+	Created int64  `json:"created"`
+	Revoked int64  `json:"revoked,omitempty"`
+	Key     string `json:"key,omitempty"`
+}
@@ -0,0 +1,320 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UnknownSize uploads content whose length isn't known upfront, the server
+// counts it while the content arrives.
+const UnknownSize = -1
+
+type UploadOptions struct {
+	Tags []string
+	// Parents creates the missing directories of the destination.
+	Parents bool
+	// Versioning overrides the versioning setting of the destination.
+	Versioning *bool
+	Conflict   Conflict
+	// ModTime is kept as the modification time of the file, the server
+	// uses the time of the upload when it is zero.
+	ModTime time.Time
+	// Progress is called with the number of bytes sent so far.
+	Progress func(sent int64)
+}
+
+func (o *UploadOptions) values() url.Values {
+	values := url.Values{}
+	if o == nil {
+		return values
+	}
+
+	for _, tag := range o.Tags {
+		values.Add("tags", tag)
+	}
+
+	formBool(values, "parents", o.Parents)
+
+	if o.Versioning != nil {
+		values.Set("versioning", strconv.FormatBool(*o.Versioning))
+	}
+
+	if o.Conflict != "" {
+		values.Set("conflict", string(o.Conflict))
+	}
+
+	if !o.ModTime.IsZero() {
+		values.Set("mtime", strconv.FormatInt(o.ModTime.Unix(), 10))
+	}
+
+	return values
+}
+
+func (o *UploadOptions) track(r io.Reader) io.Reader {
+	if o == nil || o.Progress == nil {
+		return r
+	}
+
+	return &progressReader{reader: r, progress: o.Progress}
+}
+
+// progressReader reports the bytes read through it.
+type progressReader struct {
+	reader   io.Reader
+	progress func(sent int64)
+	sent     int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.reader.Read(b)
+	if n > 0 {
+		p.sent += int64(n)
+		p.progress(p.sent)
+	}
+
+	return n, err
+}
+
+// Upload streams content to remotePath, the full path of the new file, and
+// returns its id. size is the length of content or UnknownSize. The server
+// fragments the content while it arrives, use WaitForUpload to know when
+// every fragment is stored.
+func (c *Client) Upload(ctx context.Context, remotePath string, content io.Reader, size int64,
+	opts *UploadOptions,
+) (string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPut, c.url(apiPath("/upload", remotePath),
+		opts.values()), opts.track(content))
+	if err != nil {
+		return "", err
+	}
+
+	request.Header.Set("Content-Type", "application/octet-stream")
+
+	// a negative length makes the request chunked.
+	request.ContentLength = size
+	if size == 0 {
+		request.Body = http.NoBody
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return "", err
+	}
+
+	return readText(response)
+}
+
+// UploadFile is a file of a multi file upload.
+type UploadFile struct {
+	Name string
+	// RelativePath places the file under the destination directory, like a
+	// folder upload does, for instance photos/2023/a.jpg.
+	RelativePath string
+	Content      io.Reader
+}
+
+// UploadFiles uploads files into dir in a single multipart request.
+func (c *Client) UploadFiles(ctx context.Context, dir string, files []UploadFile, opts *UploadOptions,
+) ([]UploadResult, error) {
+	fields := opts.values()
+	fields.Set("path", dir)
+
+	relative := false
+
+	for _, file := range files {
+		relative = relative || file.RelativePath != ""
+	}
+
+	// relative paths are sent for every file or none of them.
+	if relative {
+		for _, file := range files {
+			name := file.RelativePath
+			if name == "" {
+				name = file.Name
+			}
+
+			fields.Add("relative_path", name)
+		}
+	}
+
+	response, err := c.sendMultipart(ctx, fields, files, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(response.Header.Get("Content-Type"), "application/json") {
+		id, err := readText(response)
+		if err != nil {
+			return nil, err
+		}
+
+		return []UploadResult{{ID: id, Name: files[0].Name, Path: dir}}, nil
+	}
+
+	var results []UploadResult
+
+	return results, decode(response, &results)
+}
+
+// Extract uploads a zip, tar or tar.gz archive and unpacks it into dir on the
+// server. The archive is extracted in the background, the returned job id is
+// followed with Job or WaitForJob.
+func (c *Client) Extract(ctx context.Context, dir string, name string, archive io.Reader, opts *UploadOptions,
+) (string, error) {
+	fields := opts.values()
+	fields.Set("path", dir)
+	fields.Set("extract", "true")
+
+	response, err := c.sendMultipart(ctx, fields, []UploadFile{{Name: name, Content: archive}}, opts)
+	if err != nil {
+		return "", err
+	}
+
+	var accepted struct {
+		Job string `json:"job"`
+	}
+
+	return accepted.Job, decode(response, &accepted)
+}
+
+// sendMultipart streams a multipart form, the files are read while the
+// request is sent.
+func (c *Client) sendMultipart(ctx context.Context, fields url.Values, files []UploadFile, opts *UploadOptions,
+) (*http.Response, error) {
+	reader, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+
+	go func() {
+		writer.CloseWithError(writeForm(form, fields, files))
+	}()
+
+	response, err := c.send(ctx, http.MethodPost, apiPrefix+"/upload", nil, opts.track(reader),
+		form.FormDataContentType())
+
+	// unblocks the writer when the request failed before reading the body.
+	_ = reader.Close()
+
+	return response, err
+}
+
+func writeForm(form *multipart.Writer, fields url.Values, files []UploadFile) error {
+	for key, values := range fields {
+		for _, value := range values {
+			if err := form.WriteField(key, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, file := range files {
+		part, err := form.CreateFormFile("file", file.Name)
+		if err != nil {
+			return err
+		}
+
+		if _, err = io.Copy(part, file.Content); err != nil {
+			return err
+		}
+	}
+
+	return form.Close()
+}
+
+// Import makes the server download sourceURL into dir, name defaults to
+// the name the remote server gives the file. The download runs in the
+// background, its progress is reported by Status.
+func (c *Client) Import(ctx context.Context, sourceURL string, dir string, name string, opts *UploadOptions,
+) (string, error) {
+	form := opts.values()
+	form.Set("url", sourceURL)
+	form.Set("path", dir)
+
+	if name != "" {
+		form.Set("name", name)
+	}
+
+	response, err := c.sendForm(ctx, http.MethodPost, apiPrefix+"/import", form)
+	if err != nil {
+		return "", err
+	}
+
+	return readText(response)
+}
+
+// Status reports how many fragments of an upload are stored.
+func (c *Client) Status(ctx context.Context, id string) (*Status, error) {
+	response, err := c.send(ctx, http.MethodGet, apiPrefix+"/status/"+id, nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var status Status
+
+	return &status, decode(response, &status)
+}
+
+// WaitForUpload polls Status until every fragment of an upload is stored or
+// ctx is done. A failed upload returns its status along with an error.
+func (c *Client) WaitForUpload(ctx context.Context, id string) (*Status, error) {
+	return poll(ctx, c.pollInterval, func() (*Status, bool, error) {
+		status, err := c.Status(ctx, id)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if status.State == StateFailed {
+			return status, true, fmt.Errorf("the upload failed: %s", status.Error)
+		}
+
+		return status, status.State == StateDone, nil
+	})
+}
+
+// Job returns the state of a background job, like an archive extraction.
+func (c *Client) Job(ctx context.Context, id string) (*Job, error) {
+	response, err := c.send(ctx, http.MethodGet, apiPrefix+"/jobs/"+id, nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var job Job
+
+	return &job, decode(response, &job)
+}
+
+// WaitForJob polls Job until the job has finished or ctx is done.
+func (c *Client) WaitForJob(ctx context.Context, id string) (*Job, error) {
+	return poll(ctx, c.pollInterval, func() (*Job, bool, error) {
+		job, err := c.Job(ctx, id)
+		if err != nil {
+			return nil, false, err
+		}
+
+		return job, job.State != JobRunning, nil
+	})
+}
+
+func poll[T any](ctx context.Context, interval time.Duration, check func() (T, bool, error)) (T, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		value, done, err := check()
+		if err != nil || done {
+			return value, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return value, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// SetVersioning turns versioning of the files in a directory on or off.
+func (c *Client) SetVersioning(ctx context.Context, dirID string, enabled bool) error {
+	form := url.Values{"enabled": {strconv.FormatBool(enabled)}}
+
+	response, err := c.sendForm(ctx, http.MethodPost, apiPrefix+"/versioning/"+dirID, form)
+	if err != nil {
+		return err
+	}
+
+	closeBody(response)
+
+	return nil
+}
+
+// ListVersions returns the current version of a file followed by its
+// archived versions.
+func (c *Client) ListVersions(ctx context.Context, id string) ([]Version, error) {
+	response, err := c.send(ctx, http.MethodGet, apiPrefix+"/versions/"+id, nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Versions []Version `json:"versions"`
+	}
+
+	return result.Versions, decode(response, &result)
+}
+
+// DownloadVersion returns the content of an archived version.
+func (c *Client) DownloadVersion(ctx context.Context, id string, version int) (io.ReadCloser, error) {
+	response, err := c.send(ctx, http.MethodGet, apiPrefix+"/versions/"+id+"/"+strconv.Itoa(version), nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Body, nil
+}
+
+// RestoreVersion makes an archived version the current content of a file and
+// returns the number of the new current version.
+func (c *Client) RestoreVersion(ctx context.Context, id string, version int) (int, error) {
+	response, err := c.send(ctx, http.MethodPost,
+		apiPrefix+"/versions/"+id+"/"+strconv.Itoa(version)+"/restore", nil, nil, "")
+	if err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		Version int `json:"version"`
+	}
+
+	return result.Version, decode(response, &result)
+}
+
+// PruneVersions deletes the archived versions beyond the newest keep, or
+// archived longer than olderThan ago. A negative keep or a zero olderThan
+// leaves that criterion out.
+func (c *Client) PruneVersions(ctx context.Context, id string, keep int, olderThan time.Duration) (int64, error) {
+	query := url.Values{}
+
+	if keep >= 0 {
+		query.Set("keep", strconv.Itoa(keep))
+	}
+
+	if olderThan > 0 {
+		query.Set("older_than", olderThan.String())
+	}
+
+	response, err := c.send(ctx, http.MethodDelete, apiPrefix+"/versions/"+id, query, nil, "")
+	if err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		Deleted int64 `json:"deleted"`
+	}
+
+	return result.Deleted, decode(response, &result)
+}
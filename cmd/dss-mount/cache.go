@@ -0,0 +1,149 @@
+//go:build linux
+
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"dss-main/client"
+)
+
+// blockKey identifies a block of a single content of a file, versioned
+// files keep their id when their content changes but not their creation time.
+type blockKey struct {
+	id      string
+	created int64
+	index   int64
+}
+
+type block struct {
+	key  blockKey
+	data []byte
+}
+
+// blockCache keeps the most recently read blocks of files in memory. A block
+// is fetched with a single range request, so with blocks as large as the
+// fragments of the server every miss fetches a single fragment.
+type blockCache struct {
+	client    *client.Client
+	blockSize int64
+	capacity  int
+
+	mu     sync.Mutex
+	blocks map[blockKey]*list.Element
+	order  *list.List
+}
+
+// newBlockCache keeps up to size bytes of blocks of blockSize bytes.
+func newBlockCache(c *client.Client, blockSize int64, size int64) *blockCache {
+	capacity := int(size / blockSize)
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &blockCache{
+		client:    c,
+		blockSize: blockSize,
+		capacity:  capacity,
+		blocks:    map[blockKey]*list.Element{},
+		order:     list.New(),
+	}
+}
+
+// ReadAt reads the content of file at off like io.ReaderAt does.
+func (c *blockCache) ReadAt(ctx context.Context, file *client.File, p []byte, off int64) (int, error) {
+	if off >= file.Bytes {
+		return 0, io.EOF
+	}
+
+	n := 0
+
+	for n < len(p) && off+int64(n) < file.Bytes {
+		position := off + int64(n)
+		index := position / c.blockSize
+
+		data, err := c.block(ctx, file, index)
+		if err != nil {
+			return n, err
+		}
+
+		n += copy(p[n:], data[position-index*c.blockSize:])
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func (c *blockCache) block(ctx context.Context, file *client.File, index int64) ([]byte, error) {
+	key := blockKey{id: file.ID, created: file.CreationTime, index: index}
+
+	c.mu.Lock()
+	if element, found := c.blocks[key]; found {
+		c.order.MoveToFront(element)
+		c.mu.Unlock()
+
+		return element.Value.(*block).data, nil
+	}
+	c.mu.Unlock()
+
+	start := index * c.blockSize
+
+	length := file.Bytes - start
+	if length > c.blockSize {
+		length = c.blockSize
+	}
+
+	data, err := c.fetch(ctx, file.ID, start, length)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, found := c.blocks[key]; !found {
+		c.blocks[key] = c.order.PushFront(&block{key: key, data: data})
+	}
+
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Remove(c.order.Back()).(*block)
+		delete(c.blocks, oldest.key)
+	}
+
+	return data, nil
+}
+
+func (c *blockCache) fetch(ctx context.Context, id string, offset int64, length int64) ([]byte, error) {
+	body, err := c.client.Download(ctx, id, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data := make([]byte, length)
+	if _, err = io.ReadFull(body, data); err != nil {
+		return nil, fmt.Errorf("reading %d bytes at %d of %s: %w", length, offset, id, err)
+	}
+
+	return data, nil
+}
+
+// drop forgets every block of a file.
+func (c *blockCache) drop(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, element := range c.blocks {
+		if key.id == id {
+			c.order.Remove(element)
+			delete(c.blocks, key)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"path"
+	"syscall"
+
+	"dss-main/client"
+
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	log "github.com/sirupsen/logrus"
+)
+
+// node is a file or a directory of the mount, its name is the path of the
+// inode relative to the root of the mount.
+type node struct {
+	fusefs.Inode
+	mount *mount
+}
+
+// mount holds what every node of a mount shares.
+type mount struct {
+	fsys    *remoteFS
+	client  *client.Client
+	tempDir string
+}
+
+var (
+	_ fusefs.NodeLookuper  = (*node)(nil)
+	_ fusefs.NodeGetattrer = (*node)(nil)
+	_ fusefs.NodeSetattrer = (*node)(nil)
+	_ fusefs.NodeReaddirer = (*node)(nil)
+	_ fusefs.NodeOpener    = (*node)(nil)
+	_ fusefs.NodeCreater   = (*node)(nil)
+	_ fusefs.NodeMkdirer   = (*node)(nil)
+	_ fusefs.NodeUnlinker  = (*node)(nil)
+	_ fusefs.NodeRmdirer   = (*node)(nil)
+	_ fusefs.NodeRenamer   = (*node)(nil)
+)
+
+// name is the io/fs name of the node.
+func (n *node) name() string {
+	if name := n.Path(nil); name != "" {
+		return name
+	}
+
+	return "."
+}
+
+func (n *node) child(name string) string {
+	return path.Join(n.name(), name)
+}
+
+func (n *node) stat(name string) (*fileInfo, syscall.Errno) {
+	info, err := n.mount.fsys.stat("stat", name)
+	if err != nil {
+		return nil, errno(err)
+	}
+
+	return info, fusefs.OK
+}
+
+func (n *node) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fusefs.Inode, syscall.Errno) {
+	info, status := n.stat(n.child(name))
+	if status != fusefs.OK {
+		return nil, status
+	}
+
+	fillAttr(info, &out.Attr)
+
+	return n.newChild(ctx, info), fusefs.OK
+}
+
+func (n *node) newChild(ctx context.Context, info *fileInfo) *fusefs.Inode {
+	return n.NewInode(ctx, &node{mount: n.mount}, fusefs.StableAttr{Mode: mode(info), Ino: inode(info)})
+}
+
+func (n *node) Getattr(ctx context.Context, fh fusefs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	if handle, ok := fh.(*writeHandle); ok {
+		return handle.getattr(out)
+	}
+
+	info, status := n.stat(n.name())
+	if status != fusefs.OK {
+		return status
+	}
+
+	fillAttr(info, &out.Attr)
+
+	return fusefs.OK
+}
+
+// Setattr only changes sizes, the server keeps no modes or owners and sets
+// the times itself.
+func (n *node) Setattr(ctx context.Context, fh fusefs.FileHandle, in *fuse.SetAttrIn,
+	out *fuse.AttrOut,
+) syscall.Errno {
+	size, resize := in.GetSize()
+	if !resize {
+		return n.Getattr(ctx, fh, out)
+	}
+
+	if handle, ok := fh.(*writeHandle); ok {
+		if status := handle.truncate(int64(size)); status != fusefs.OK {
+			return status
+		}
+
+		return handle.getattr(out)
+	}
+
+	// truncate(2) without an open file rewrites the file right away.
+	handle, status := n.mount.openWrite(ctx, n.name(), size == 0)
+	if status != fusefs.OK {
+		return status
+	}
+	defer handle.Release(ctx)
+
+	if status = handle.truncate(int64(size)); status != fusefs.OK {
+		return status
+	}
+
+	if status = handle.Flush(ctx); status != fusefs.OK {
+		return status
+	}
+
+	return handle.getattr(out)
+}
+
+func (n *node) Readdir(ctx context.Context) (fusefs.DirStream, syscall.Errno) {
+	entries, err := n.mount.fsys.ReadDir(n.name())
+	if err != nil {
+		return nil, errno(err)
+	}
+
+	list := make([]fuse.DirEntry, 0, len(entries))
+
+	for _, entry := range entries {
+		info := entry.(*fileInfo)
+		list = append(list, fuse.DirEntry{Name: info.Name(), Mode: mode(info), Ino: inode(info)})
+	}
+
+	return fusefs.NewListDirStream(list), fusefs.OK
+}
+
+func (n *node) Open(ctx context.Context, flags uint32) (fusefs.FileHandle, uint32, syscall.Errno) {
+	if flags&syscall.O_ACCMODE == syscall.O_RDONLY {
+		file, err := n.mount.fsys.Open(n.name())
+		if err != nil {
+			return nil, 0, errno(err)
+		}
+
+		return &readHandle{file: file.(*remoteFile)}, 0, fusefs.OK
+	}
+
+	handle, status := n.mount.openWrite(ctx, n.name(), flags&syscall.O_TRUNC != 0)
+	if status != fusefs.OK {
+		return nil, 0, status
+	}
+
+	return handle, fuse.FOPEN_DIRECT_IO, fusefs.OK
+}
+
+func (n *node) Create(ctx context.Context, name string, flags uint32, mode uint32,
+	out *fuse.EntryOut,
+) (*fusefs.Inode, fusefs.FileHandle, uint32, syscall.Errno) {
+	handle, status := n.mount.newWriteHandle(n.child(name))
+	if status != fusefs.OK {
+		return nil, nil, 0, status
+	}
+
+	// the new file is uploaded on close even when nothing is written to it.
+	handle.dirty = true
+
+	out.Mode = fuse.S_IFREG | 0o644
+	child := n.NewInode(ctx, &node{mount: n.mount}, fusefs.StableAttr{Mode: fuse.S_IFREG})
+
+	return child, handle, fuse.FOPEN_DIRECT_IO, fusefs.OK
+}
+
+func (n *node) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut,
+) (*fusefs.Inode, syscall.Errno) {
+	created, err := n.mount.client.Mkdir(ctx, n.mount.fsys.remote(n.name()), name,
+		&client.MkdirOptions{Conflict: client.ConflictFail})
+	if err != nil {
+		return nil, errno(err)
+	}
+
+	n.mount.fsys.invalidate(n.child(name))
+
+	info := &fileInfo{file: *created}
+	fillAttr(info, &out.Attr)
+
+	return n.newChild(ctx, info), fusefs.OK
+}
+
+func (n *node) Unlink(ctx context.Context, name string) syscall.Errno {
+	return n.remove(ctx, name)
+}
+
+func (n *node) Rmdir(ctx context.Context, name string) syscall.Errno {
+	status := n.remove(ctx, name)
+	if status == syscall.EEXIST {
+		return syscall.ENOTEMPTY
+	}
+
+	return status
+}
+
+func (n *node) remove(ctx context.Context, name string) syscall.Errno {
+	info, status := n.stat(n.child(name))
+	if status != fusefs.OK {
+		return status
+	}
+
+	if err := n.mount.client.Delete(ctx, info.file.ID, false); err != nil {
+		return errno(err)
+	}
+
+	n.mount.fsys.invalidate(n.child(name))
+	n.mount.fsys.blocks.drop(info.file.ID)
+
+	return fusefs.OK
+}
+
+// Rename moves and renames through the server, an existing destination is
+// replaced like rename(2) does unless RENAME_NOREPLACE is set.
+func (n *node) Rename(ctx context.Context, name string, newParent fusefs.InodeEmbedder, newName string,
+	flags uint32,
+) syscall.Errno {
+	const renameNoReplace = 1
+
+	conflict := client.ConflictOverwrite
+	switch flags {
+	case 0:
+	case renameNoReplace:
+		conflict = client.ConflictFail
+	default:
+		return syscall.EINVAL
+	}
+
+	info, status := n.stat(n.child(name))
+	if status != fusefs.OK {
+		return status
+	}
+
+	target := newParent.(*node)
+	destination := target.child(newName)
+
+	defer n.mount.fsys.invalidate(n.child(name), destination)
+
+	if target.name() == n.name() && newName == name {
+		return fusefs.OK
+	}
+
+	// a single move keeps the policy off an intermediate path.
+	remote := n.mount.fsys.remote(target.name())
+	if err := n.mount.client.MoveAs(ctx, info.file.ID, remote, newName, conflict); err != nil {
+		return errno(err)
+	}
+
+	return fusefs.OK
+}
+
+// readHandle reads an open file through the block cache.
+type readHandle struct {
+	file *remoteFile
+}
+
+var _ fusefs.FileReader = (*readHandle)(nil)
+
+func (h *readHandle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	n, err := h.file.fsys.blocks.ReadAt(ctx, &h.file.info.file, dest, off)
+	if err != nil && n == 0 && !errors.Is(err, io.EOF) {
+		return nil, errno(err)
+	}
+
+	return fuse.ReadResultData(dest[:n]), fusefs.OK
+}
+
+func fillAttr(info *fileInfo, out *fuse.Attr) {
+	out.Mode = mode(info) | uint32(info.Mode().Perm())
+	out.Ino = inode(info)
+	out.Size = uint64(info.Size())
+	out.Blocks = (out.Size + 511) / 512
+	out.Nlink = 1
+
+	modified := uint64(info.ModTime().Unix())
+	out.Mtime, out.Ctime, out.Atime = modified, modified, modified
+}
+
+func mode(info *fileInfo) uint32 {
+	if info.IsDir() {
+		return fuse.S_IFDIR
+	}
+
+	return fuse.S_IFREG
+}
+
+// inode derives a stable inode number from the id of a file.
+func inode(info *fileInfo) uint64 {
+	if info.file.ID == "" {
+		return 1
+	}
+
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(info.file.ID))
+
+	return hash.Sum64()
+}
+
+// errno maps errors of the client to the errors of system calls.
+func errno(err error) syscall.Errno {
+	switch {
+	case err == nil:
+		return fusefs.OK
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, client.ErrNotFound):
+		return syscall.ENOENT
+	case errors.Is(err, fs.ErrInvalid), errors.Is(err, client.ErrInvalid):
+		return syscall.EINVAL
+	case errors.Is(err, client.ErrConflict):
+		return syscall.EEXIST
+	case errors.Is(err, client.ErrTooLarge):
+		return syscall.EFBIG
+	case errors.Is(err, context.Canceled):
+		return syscall.EINTR
+	}
+
+	log.Error(err)
+
+	return syscall.EIO
+}
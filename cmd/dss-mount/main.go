@@ -0,0 +1,113 @@
+//go:build linux
+
+// Command dss-mount mounts a directory of a dss server as a FUSE filesystem.
+//
+// Reads fetch blocks of files with range requests and keep them in memory,
+// files opened for writing are buffered in a temp file and uploaded when
+// they are closed. Servers running with authentication take the api key or
+// jwt of $DSS_TOKEN, it is kept off the command line where ps would show it.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"dss-main/client"
+
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultURL = "http://localhost:8080"
+	// defaultBlockSize matches the fragment size of the default deployment.
+	defaultBlockSize = 8 << 20
+)
+
+func main() {
+	url := flag.String("url", "", "the url of the server, $DSS_URL or "+defaultURL+" when empty")
+	root := flag.String("root", "/", "the directory of the namespace to mount")
+	blockSize := flag.Int64("block-size", defaultBlockSize,
+		"the size of the blocks reads fetch, the FRAGMENT_SIZE of the server fetches single fragments")
+	cacheSize := flag.Int64("cache-size", 32*defaultBlockSize, "how many bytes of blocks to keep in memory")
+	ttl := flag.Duration("ttl", 5*time.Second, "how long listings and attributes are cached")
+	readOnly := flag.Bool("ro", false, "mount read only")
+	debug := flag.Bool("debug", false, "log every FUSE request")
+
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: dss-mount [flags] mountpoint")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 || *blockSize <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *url == "" {
+		*url = os.Getenv("DSS_URL")
+	}
+
+	if *url == "" {
+		*url = defaultURL
+	}
+
+	c, err := client.New(*url, client.WithToken(os.Getenv("DSS_TOKEN")))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fsys := newRemoteFS(ctx, c, newBlockCache(c, *blockSize, *cacheSize), *root, *ttl)
+
+	info, err := fsys.Stat(".")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if !info.IsDir() {
+		log.Fatalf("%s is not a directory", *root)
+	}
+
+	options := &fusefs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName: "dss:" + fsys.root,
+			Name:   "dss",
+			Debug:  *debug,
+		},
+		EntryTimeout:    ttl,
+		AttrTimeout:     ttl,
+		NegativeTimeout: ttl,
+		UID:             uint32(os.Getuid()),
+		GID:             uint32(os.Getgid()),
+	}
+
+	if *readOnly {
+		options.MountOptions.Options = append(options.MountOptions.Options, "ro")
+	}
+
+	server, err := fusefs.Mount(flag.Arg(0), &node{mount: &mount{fsys: fsys, client: c}}, options)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		if unmountErr := server.Unmount(); unmountErr != nil {
+			log.Error(unmountErr)
+		}
+	}()
+
+	log.Infof("mounted %s of %s on %s", fsys.root, *url, flag.Arg(0))
+	server.Wait()
+}
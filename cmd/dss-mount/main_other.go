@@ -0,0 +1,15 @@
+//go:build !linux
+
+// Command dss-mount mounts a directory of a dss server as a FUSE filesystem,
+// it only runs on linux.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Fprintln(os.Stderr, "dss-mount: FUSE mounts are only supported on linux")
+	os.Exit(1)
+}
@@ -0,0 +1,264 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sync"
+	"time"
+
+	"dss-main/client"
+)
+
+// remoteFS is an io/fs view of a directory of the namespace, names are
+// relative to that directory. Listings are kept for ttl so that looking up
+// every file of a directory doesn't list it every time.
+type remoteFS struct {
+	ctx    context.Context
+	client *client.Client
+	blocks *blockCache
+	root   string
+	ttl    time.Duration
+
+	mu       sync.Mutex
+	listings map[string]listing
+}
+
+type listing struct {
+	files   []client.File
+	fetched time.Time
+}
+
+func newRemoteFS(ctx context.Context, c *client.Client, blocks *blockCache, root string, ttl time.Duration,
+) *remoteFS {
+	return &remoteFS{
+		ctx:      ctx,
+		client:   c,
+		blocks:   blocks,
+		root:     path.Clean("/" + root),
+		ttl:      ttl,
+		listings: map[string]listing{},
+	}
+}
+
+// remote returns the path of the namespace a name refers to.
+func (r *remoteFS) remote(name string) string {
+	return path.Join(r.root, name)
+}
+
+func (r *remoteFS) Open(name string) (fs.File, error) {
+	info, err := r.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &remoteFile{fsys: r, info: info}, nil
+}
+
+func (r *remoteFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := r.stat("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (r *remoteFS) stat(op string, name string) (*fileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	remote := r.remote(name)
+	if remote == "/" {
+		return &fileInfo{file: client.File{Name: "/", Path: "/", IsDirectory: true}}, nil
+	}
+
+	files, err := r.list(path.Dir(remote))
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	for i := range files {
+		if files[i].Name == path.Base(remote) {
+			return &fileInfo{file: files[i]}, nil
+		}
+	}
+
+	return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+func (r *remoteFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	files, err := r.list(r.remote(name))
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(files))
+	for i := range files {
+		entries = append(entries, &fileInfo{file: files[i]})
+	}
+
+	return entries, nil
+}
+
+// list returns the entries of a directory of the namespace.
+func (r *remoteFS) list(dir string) ([]client.File, error) {
+	r.mu.Lock()
+	cached, found := r.listings[dir]
+	r.mu.Unlock()
+
+	if found && time.Since(cached.fetched) < r.ttl {
+		return cached.files, nil
+	}
+
+	files, err := r.client.DirAll(r.ctx, dir, nil)
+	if errors.Is(err, client.ErrNotFound) {
+		return nil, fs.ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.listings[dir] = listing{files: files, fetched: time.Now()}
+	r.mu.Unlock()
+
+	return files, nil
+}
+
+// invalidate forgets the listings of the directories holding names, after
+// they were changed through the mount.
+func (r *remoteFS) invalidate(names ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, name := range names {
+		delete(r.listings, path.Dir(r.remote(name)))
+		delete(r.listings, r.remote(name))
+	}
+}
+
+// fileInfo is both the fs.FileInfo and the fs.DirEntry of a file.
+type fileInfo struct {
+	file client.File
+}
+
+func (i *fileInfo) Name() string { return i.file.Name }
+func (i *fileInfo) Size() int64  { return i.file.Bytes }
+func (i *fileInfo) IsDir() bool  { return i.file.IsDirectory }
+func (i *fileInfo) Sys() any     { return &i.file }
+
+func (i *fileInfo) Mode() fs.FileMode {
+	if i.file.IsDirectory {
+		return fs.ModeDir | 0o755
+	}
+
+	return 0o644
+}
+
+func (i *fileInfo) ModTime() time.Time {
+	return time.Unix(i.file.CreationTime, 0)
+}
+
+func (i *fileInfo) Type() fs.FileMode {
+	return i.Mode().Type()
+}
+
+func (i *fileInfo) Info() (fs.FileInfo, error) {
+	return i, nil
+}
+
+// remoteFile reads a file through the block cache, directories are read
+// with ReadDir.
+type remoteFile struct {
+	fsys    *remoteFS
+	info    *fileInfo
+	offset  int64
+	entries []fs.DirEntry
+	listed  bool
+}
+
+func (f *remoteFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *remoteFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+
+	return n, err
+}
+
+func (f *remoteFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.info.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.info.file.Path, Err: errors.New("is a directory")}
+	}
+
+	return f.fsys.blocks.ReadAt(f.fsys.ctx, &f.info.file, p, off)
+}
+
+func (f *remoteFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.Size()
+	}
+
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.info.file.Path, Err: fs.ErrInvalid}
+	}
+
+	f.offset = offset
+
+	return offset, nil
+}
+
+// ReadDir reads the directory like fs.ReadDirFile does, the listing is
+// read once when the first entries are asked for.
+func (f *remoteFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.listed {
+		files, err := f.fsys.list(f.info.file.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range files {
+			f.entries = append(f.entries, &fileInfo{file: files[i]})
+		}
+
+		f.listed = true
+	}
+
+	if n <= 0 {
+		entries := f.entries
+		f.entries = nil
+
+		return entries, nil
+	}
+
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > len(f.entries) {
+		n = len(f.entries)
+	}
+
+	entries := f.entries[:n]
+	f.entries = f.entries[n:]
+
+	return entries, nil
+}
+
+func (f *remoteFile) Close() error {
+	return nil
+}
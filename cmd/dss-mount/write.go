@@ -0,0 +1,209 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"dss-main/client"
+
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	log "github.com/sirupsen/logrus"
+)
+
+// writeHandle buffers the content of a file opened for writing in a temp
+// file, the content is uploaded when the file is closed. The server stores
+// whole files only, so the upload always replaces the entire content.
+type writeHandle struct {
+	mount *mount
+	name  string
+
+	mu    sync.Mutex
+	temp  *os.File
+	dirty bool
+}
+
+var (
+	_ fusefs.FileReader   = (*writeHandle)(nil)
+	_ fusefs.FileWriter   = (*writeHandle)(nil)
+	_ fusefs.FileFlusher  = (*writeHandle)(nil)
+	_ fusefs.FileFsyncer  = (*writeHandle)(nil)
+	_ fusefs.FileReleaser = (*writeHandle)(nil)
+)
+
+func (m *mount) newWriteHandle(name string) (*writeHandle, syscall.Errno) {
+	temp, err := os.CreateTemp(m.tempDir, "dss-mount-*")
+	if err != nil {
+		log.Error(err)
+		return nil, syscall.EIO
+	}
+
+	return &writeHandle{mount: m, name: name, temp: temp}, fusefs.OK
+}
+
+// openWrite opens an existing file for writing, its current content is
+// downloaded first unless it is truncated anyway.
+func (m *mount) openWrite(ctx context.Context, name string, truncate bool) (*writeHandle, syscall.Errno) {
+	info, err := m.fsys.stat("open", name)
+	if err != nil {
+		return nil, errno(err)
+	}
+
+	if info.IsDir() {
+		return nil, syscall.EISDIR
+	}
+
+	handle, status := m.newWriteHandle(name)
+	if status != fusefs.OK {
+		return nil, status
+	}
+
+	if truncate {
+		handle.dirty = true
+		return handle, fusefs.OK
+	}
+
+	content := io.NewSectionReader(readerAt(func(p []byte, off int64) (int, error) {
+		return m.fsys.blocks.ReadAt(ctx, &info.file, p, off)
+	}), 0, info.Size())
+
+	if _, err = io.Copy(handle.temp, content); err != nil {
+		handle.Release(ctx)
+		return nil, errno(err)
+	}
+
+	return handle, fusefs.OK
+}
+
+// readerAt turns a function into an io.ReaderAt.
+type readerAt func(p []byte, off int64) (int, error)
+
+func (r readerAt) ReadAt(p []byte, off int64) (int, error) {
+	return r(p, off)
+}
+
+func (h *writeHandle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n, err := h.temp.ReadAt(dest, off)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, errno(err)
+	}
+
+	return fuse.ReadResultData(dest[:n]), fusefs.OK
+}
+
+func (h *writeHandle) Write(ctx context.Context, data []byte, off int64) (uint32, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n, err := h.temp.WriteAt(data, off)
+	if err != nil {
+		log.Error(err)
+		return uint32(n), syscall.EIO
+	}
+
+	h.dirty = true
+
+	return uint32(n), fusefs.OK
+}
+
+func (h *writeHandle) truncate(size int64) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.temp.Truncate(size); err != nil {
+		log.Error(err)
+		return syscall.EIO
+	}
+
+	h.dirty = true
+
+	return fusefs.OK
+}
+
+func (h *writeHandle) getattr(out *fuse.AttrOut) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	info, err := h.temp.Stat()
+	if err != nil {
+		log.Error(err)
+		return syscall.EIO
+	}
+
+	out.Mode = fuse.S_IFREG | 0o644
+	out.Size = uint64(info.Size())
+	out.Blocks = (out.Size + 511) / 512
+	out.Nlink = 1
+
+	modified := info.ModTime()
+	out.SetTimes(&modified, &modified, &modified)
+
+	return fusefs.OK
+}
+
+// Flush uploads the content when it changed, close(2) returns once every
+// fragment of it is stored so that it can be read back right away.
+func (h *writeHandle) Flush(ctx context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.dirty {
+		return fusefs.OK
+	}
+
+	info, err := h.temp.Stat()
+	if err != nil {
+		log.Error(err)
+		return syscall.EIO
+	}
+
+	fsys := h.mount.fsys
+
+	id, err := h.mount.client.Upload(ctx, fsys.remote(h.name), io.NewSectionReader(h.temp, 0, info.Size()),
+		info.Size(), &client.UploadOptions{Conflict: client.ConflictOverwrite, ModTime: time.Now()})
+	if err != nil {
+		return errno(err)
+	}
+
+	fsys.invalidate(h.name)
+	fsys.blocks.drop(id)
+
+	if _, err = h.mount.client.WaitForUpload(ctx, id); err != nil {
+		return errno(err)
+	}
+
+	h.dirty = false
+
+	return fusefs.OK
+}
+
+func (h *writeHandle) Fsync(ctx context.Context, flags uint32) syscall.Errno {
+	return h.Flush(ctx)
+}
+
+// Release drops the temp file, a failed upload was already reported by Flush.
+func (h *writeHandle) Release(ctx context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.temp.Close(); err != nil && !errors.Is(err, fs.ErrClosed) {
+		log.Error(err)
+	}
+
+	if err := os.Remove(h.temp.Name()); err != nil {
+		log.Error(err)
+	}
+
+	return fusefs.OK
+}
@@ -0,0 +1,556 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"dss-main/client"
+
+	"github.com/dustin/go-humanize"
+)
+
+func flags(name string) *flag.FlagSet {
+	set := flag.NewFlagSet(name, flag.ExitOnError)
+	set.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: dss", commands()[name].usage)
+		set.PrintDefaults()
+	}
+
+	return set
+}
+
+// remotePath cleans a path of the namespace, relative paths start at the root.
+func remotePath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// resolve finds the file or directory at a path of the namespace.
+func resolve(ctx context.Context, c *client.Client, p string) (*client.File, error) {
+	p = remotePath(p)
+
+	if p == "/" {
+		root, err := c.Tree(ctx, "/", 1)
+		if err != nil {
+			return nil, err
+		}
+
+		return &root.File, nil
+	}
+
+	files, err := c.DirAll(ctx, path.Dir(p), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range files {
+		if files[i].Name == path.Base(p) {
+			return &files[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s: %w", p, client.ErrNotFound)
+}
+
+func runLs(ctx context.Context, c *client.Client, args []string) error {
+	set := flags("ls")
+	long := set.Bool("l", false, "show the size, creation time and id of the entries")
+	_ = set.Parse(args)
+
+	target := "/"
+	if set.NArg() > 0 {
+		target = set.Arg(0)
+	}
+
+	file, err := resolve(ctx, c, target)
+	if err != nil {
+		return err
+	}
+
+	entries := []client.File{*file}
+
+	if file.IsDirectory {
+		if entries, err = c.DirAll(ctx, file.Path, nil); err != nil {
+			return err
+		}
+	}
+
+	if !*long {
+		for _, entry := range entries {
+			fmt.Println(displayName(entry))
+		}
+
+		return nil
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	for _, entry := range entries {
+		created := time.Unix(entry.CreationTime, 0).Format("2006-01-02 15:04")
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\t %s\n", kind(entry), entry.Size, created, entry.ID, displayName(entry))
+	}
+
+	return out.Flush()
+}
+
+func kind(file client.File) string {
+	switch {
+	case file.IsDirectory:
+		return "d"
+	case file.IsProcessing:
+		return "~"
+	}
+
+	return "-"
+}
+
+func displayName(file client.File) string {
+	if file.IsDirectory {
+		return file.Name + "/"
+	}
+
+	return file.Name
+}
+
+func runTree(ctx context.Context, c *client.Client, args []string) error {
+	set := flags("tree")
+	depth := set.Int("depth", 0, "how many levels to show, the server default when 0")
+	_ = set.Parse(args)
+
+	target := "/"
+	if set.NArg() > 0 {
+		target = set.Arg(0)
+	}
+
+	root, err := c.Tree(ctx, remotePath(target), *depth)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(root.Path)
+	printTree(root, "")
+
+	return nil
+}
+
+func printTree(node *client.TreeNode, indent string) {
+	for i, child := range node.Children {
+		branch, next := "├── ", "│   "
+		if i == len(node.Children)-1 {
+			branch, next = "└── ", "    "
+		}
+
+		name := displayName(child.File)
+		if child.Truncated {
+			name += " …"
+		}
+
+		fmt.Println(indent + branch + name)
+		printTree(child, indent+next)
+	}
+}
+
+func runPut(ctx context.Context, c *client.Client, args []string) error {
+	set := flags("put")
+	recursive := set.Bool("r", false, "upload directories with everything in them")
+	parents := set.Bool("p", false, "create the remote directory when it is missing")
+	quiet := set.Bool("q", false, "don't draw progress bars")
+	tags := set.String("tags", "", "comma separated tags of the uploaded files")
+	conflict := set.String("conflict", "", "rename, overwrite, fail or skip when a file exists")
+	wait := set.Bool("wait", false, "wait until every fragment of the uploads is stored")
+	_ = set.Parse(args)
+
+	if set.NArg() < 2 {
+		set.Usage()
+		os.Exit(2)
+	}
+
+	locals, remoteDir := set.Args()[:set.NArg()-1], remotePath(set.Arg(set.NArg()-1))
+
+	up := &uploader{client: c, quiet: *quiet, wait: *wait, opts: client.UploadOptions{
+		Parents:  *parents,
+		Conflict: client.Conflict(*conflict),
+	}}
+
+	if *tags != "" {
+		up.opts.Tags = strings.Split(*tags, ",")
+	}
+
+	for _, local := range locals {
+		info, err := os.Stat(local)
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			err = up.put(ctx, local, path.Join(remoteDir, info.Name()), info.Size(), up.opts)
+		} else if *recursive {
+			err = up.putDir(ctx, local, path.Join(remoteDir, info.Name()))
+		} else {
+			err = fmt.Errorf("%s is a directory, use -r to upload it", local)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type uploader struct {
+	client *client.Client
+	opts   client.UploadOptions
+	quiet  bool
+	wait   bool
+}
+
+func (u *uploader) putDir(ctx context.Context, localDir string, remoteDir string) error {
+	return filepath.WalkDir(localDir, func(local string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+
+		relative, err := filepath.Rel(localDir, local)
+		if err != nil {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		// the directories of the tree are created along the way.
+		opts := u.opts
+		opts.Parents = true
+
+		return u.put(ctx, local, path.Join(remoteDir, filepath.ToSlash(relative)), info.Size(), opts)
+	})
+}
+
+func (u *uploader) put(ctx context.Context, local string, remote string, size int64,
+	opts client.UploadOptions,
+) error {
+	file, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var bar *progressBar
+	if !u.quiet {
+		bar = newProgressBar(os.Stderr, remote, size, 0)
+		opts.Progress = bar.update
+	}
+
+	id, err := u.client.Upload(ctx, remote, file, size, &opts)
+	if err != nil {
+		if bar != nil {
+			fmt.Fprintln(os.Stderr)
+		}
+
+		return fmt.Errorf("%s: %w", local, err)
+	}
+
+	bar.done(size)
+
+	if u.wait {
+		if _, err = u.client.WaitForUpload(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println(id, remote)
+
+	return nil
+}
+
+func runGet(ctx context.Context, c *client.Client, args []string) error {
+	set := flags("get")
+	quiet := set.Bool("q", false, "don't draw a progress bar")
+	_ = set.Parse(args)
+
+	if set.NArg() < 1 || set.NArg() > 2 {
+		set.Usage()
+		os.Exit(2)
+	}
+
+	remote, err := resolve(ctx, c, set.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if remote.IsDirectory {
+		return fmt.Errorf("%s is a directory", remote.Path)
+	}
+
+	local := remote.Name
+	if set.NArg() == 2 {
+		local = set.Arg(1)
+		if info, statErr := os.Stat(local); statErr == nil && info.IsDir() {
+			local = filepath.Join(local, remote.Name)
+		}
+	}
+
+	// a partial local file is resumed from where it ends.
+	var offset int64
+
+	info, statErr := os.Stat(local)
+	if statErr == nil {
+		offset = info.Size()
+	}
+
+	if statErr == nil && offset == remote.Bytes {
+		fmt.Fprintln(os.Stderr, local, "is already downloaded")
+		return nil
+	}
+
+	mode := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if offset > remote.Bytes {
+		offset = 0
+		mode |= os.O_TRUNC
+	}
+
+	body, err := c.Download(ctx, remote.ID, offset, 0)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	file, err := os.OpenFile(local, mode, 0o644)
+	if err != nil {
+		return err
+	}
+
+	reader := &countingReader{reader: body}
+
+	var bar *progressBar
+	if !*quiet {
+		bar = newProgressBar(os.Stderr, local, remote.Bytes, offset)
+		reader.progress = bar.update
+	}
+
+	_, err = io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		if bar != nil {
+			fmt.Fprintln(os.Stderr)
+		}
+
+		return fmt.Errorf("the download stopped, run get again to resume it: %w", err)
+	}
+
+	bar.done(reader.read)
+
+	return nil
+}
+
+// destination splits the target of mv and cp into a directory and a name,
+// an existing directory receives the source under its own name.
+func destination(ctx context.Context, c *client.Client, source *client.File, target string,
+) (string, string, error) {
+	target = remotePath(target)
+
+	existing, err := resolve(ctx, c, target)
+	if err == nil && existing.IsDirectory {
+		return target, source.Name, nil
+	} else if err != nil && !errors.Is(err, client.ErrNotFound) {
+		return "", "", err
+	}
+
+	return path.Dir(target), path.Base(target), nil
+}
+
+func runMv(ctx context.Context, c *client.Client, args []string) error {
+	set := flags("mv")
+	conflict := set.String("conflict", "", "rename, overwrite, fail or skip when the destination exists")
+	_ = set.Parse(args)
+
+	if set.NArg() != 2 {
+		set.Usage()
+		os.Exit(2)
+	}
+
+	source, err := resolve(ctx, c, set.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	dir, name, err := destination(ctx, c, source, set.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	if dir == path.Dir(source.Path) && name == source.Name {
+		return nil
+	}
+
+	return c.MoveAs(ctx, source.ID, dir, name, client.Conflict(*conflict))
+}
+
+func runCp(ctx context.Context, c *client.Client, args []string) error {
+	set := flags("cp")
+	conflict := set.String("conflict", "", "rename, overwrite, fail or skip when the destination exists")
+	_ = set.Parse(args)
+
+	if set.NArg() != 2 {
+		set.Usage()
+		os.Exit(2)
+	}
+
+	source, err := resolve(ctx, c, set.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	dir, name, err := destination(ctx, c, source, set.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	copied, err := c.Copy(ctx, source.ID, &client.CopyOptions{
+		NewPath:  dir,
+		NewName:  name,
+		Conflict: client.Conflict(*conflict),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(copied.ID, copied.Path)
+
+	return nil
+}
+
+func runRm(ctx context.Context, c *client.Client, args []string) error {
+	set := flags("rm")
+	recursive := set.Bool("r", false, "remove directories and everything in them")
+	_ = set.Parse(args)
+
+	for _, target := range set.Args() {
+		file, err := resolve(ctx, c, target)
+		if err != nil {
+			return err
+		}
+
+		if err = c.Delete(ctx, file.ID, *recursive); err != nil {
+			return fmt.Errorf("%s: %w", file.Path, err)
+		}
+	}
+
+	return nil
+}
+
+func runMkdir(ctx context.Context, c *client.Client, args []string) error {
+	set := flags("mkdir")
+	parents := set.Bool("p", false, "create the missing parents, an existing directory is fine")
+	_ = set.Parse(args)
+
+	for _, target := range set.Args() {
+		target = remotePath(target)
+
+		_, err := c.Mkdir(ctx, path.Dir(target), path.Base(target), &client.MkdirOptions{Parents: *parents})
+		if err != nil {
+			return fmt.Errorf("%s: %w", target, err)
+		}
+	}
+
+	return nil
+}
+
+func runStat(ctx context.Context, c *client.Client, args []string) error {
+	set := flags("stat")
+	_ = set.Parse(args)
+
+	if set.NArg() != 1 {
+		set.Usage()
+		os.Exit(2)
+	}
+
+	file, err := resolve(ctx, c, set.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+
+	fmt.Fprintf(out, "path:\t%s\n", file.Path)
+	fmt.Fprintf(out, "id:\t%s\n", file.ID)
+
+	if file.IsDirectory {
+		fmt.Fprintf(out, "type:\tdirectory\n")
+	} else {
+		fmt.Fprintf(out, "type:\tfile\n")
+		fmt.Fprintf(out, "size:\t%s (%d bytes)\n", file.Size, file.Bytes)
+	}
+
+	fmt.Fprintf(out, "created:\t%s\n", time.Unix(file.CreationTime, 0).Format(time.RFC3339))
+
+	if file.IsProcessing {
+		status, statusErr := c.Status(ctx, file.ID)
+		if statusErr != nil {
+			return statusErr
+		}
+
+		fmt.Fprintf(out, "upload:\t%s\n", describeStatus(status))
+	}
+
+	return out.Flush()
+}
+
+func runStatus(ctx context.Context, c *client.Client, args []string) error {
+	set := flags("status")
+	wait := set.Bool("wait", false, "wait until every fragment is stored")
+	_ = set.Parse(args)
+
+	if set.NArg() != 1 {
+		set.Usage()
+		os.Exit(2)
+	}
+
+	status, err := c.Status(ctx, set.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *wait && status.State == client.StateInProgress {
+		fmt.Fprintln(os.Stderr, describeStatus(status))
+
+		if status, err = c.WaitForUpload(ctx, set.Arg(0)); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println(describeStatus(status))
+
+	return nil
+}
+
+func describeStatus(status *client.Status) string {
+	total := "?"
+	if status.TotalFragments != nil {
+		total = humanize.Comma(int64(*status.TotalFragments))
+	}
+
+	described := fmt.Sprintf("%s, %s of %s fragments stored", status.State,
+		humanize.Comma(int64(status.UploadedFragments)), total)
+
+	if status.Error != "" {
+		described += ": " + status.Error
+	}
+
+	return described
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultURL     = "http://localhost:8080"
+	defaultProfile = "default"
+)
+
+// profile holds the settings of one server, the profile file keeps one
+// section per profile:
+//
+//	[default]
+//	url = http://localhost:8080
+//	token = dss_...
+//
+// The token is an api key or a jwt, it is only needed by servers running
+// with authentication.
+type profile struct {
+	URL   string
+	Token string
+}
+
+// configPath is $DSS_CONFIG or ~/.config/dss/config.
+func configPath() (string, error) {
+	if path := os.Getenv("DSS_CONFIG"); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "dss", "config"), nil
+}
+
+// loadProfile reads a profile from the profile file, the environment
+// overrides it. A missing file leaves the defaults.
+func loadProfile(name string) (profile, error) {
+	if name == "" {
+		name = os.Getenv("DSS_PROFILE")
+	}
+
+	if name == "" {
+		name = defaultProfile
+	}
+
+	loaded := profile{URL: defaultURL}
+
+	path, err := configPath()
+	if err != nil {
+		return loaded, err
+	}
+
+	sections, err := readProfiles(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return loaded, err
+	}
+
+	if settings, found := sections[name]; found {
+		if url := settings["url"]; url != "" {
+			loaded.URL = url
+		}
+
+		loaded.Token = settings["token"]
+	} else if name != defaultProfile {
+		return loaded, fmt.Errorf("the profile %q is not in %s", name, path)
+	}
+
+	if url := os.Getenv("DSS_URL"); url != "" {
+		loaded.URL = url
+	}
+
+	if token := os.Getenv("DSS_TOKEN"); token != "" {
+		loaded.Token = token
+	}
+
+	return loaded, nil
+}
+
+// readProfiles parses the sections of an ini style file.
+func readProfiles(path string) (map[string]map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sections := map[string]map[string]string{}
+	current := ""
+
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			current = strings.TrimSpace(line[1 : len(line)-1])
+			sections[current] = map[string]string{}
+		default:
+			key, value, found := strings.Cut(line, "=")
+			if !found || current == "" {
+				return nil, fmt.Errorf("%s:%d: expected a [profile] or a key = value line", path, number)
+			}
+
+			sections[current][strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	return sections, scanner.Err()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"dss-main/client"
+)
+
+// runKey manages the api keys of the server, it needs an admin token.
+func runKey(ctx context.Context, c *client.Client, args []string) error {
+	set := flags("key")
+	admin := set.Bool("admin", false, "the new key can manage api keys")
+
+	if len(args) == 0 {
+		set.Usage()
+		os.Exit(2)
+	}
+
+	action := args[0]
+	_ = set.Parse(args[1:])
+
+	switch {
+	case action == "ls" && set.NArg() == 0:
+		keys, err := c.ListKeys(ctx)
+		if err != nil {
+			return err
+		}
+
+		return printKeys(keys)
+	case action == "add" && set.NArg() == 1:
+		key, err := c.IssueKey(ctx, set.Arg(0), *admin)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(os.Stderr, "issued", key.ID, "- the key can't be shown again:")
+		fmt.Println(key.Key)
+
+		return nil
+	case action == "revoke" && set.NArg() == 1:
+		return c.RevokeKey(ctx, set.Arg(0))
+	}
+
+	set.Usage()
+	os.Exit(2)
+
+	return nil
+}
+
+func printKeys(keys []client.APIKey) error {
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	for _, key := range keys {
+		role := "user"
+		if key.Admin {
+			role = "admin"
+		}
+
+		state := "active"
+		if key.Revoked != 0 {
+			state = "revoked " + time.Unix(key.Revoked, 0).Format("2006-01-02 15:04")
+		}
+
+		created := time.Unix(key.Created, 0).Format("2006-01-02 15:04")
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\n", key.ID, role, created, state, key.Name)
+	}
+
+	return out.Flush()
+}
@@ -0,0 +1,104 @@
+// Command dss is a command-line client of a dss server.
+//
+// The server is picked by -url, $DSS_URL or a profile of the profile file,
+// see loadProfile. Servers running with authentication take the api key or
+// jwt of the profile, or of $DSS_TOKEN.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+
+	"dss-main/client"
+)
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, c *client.Client, args []string) error
+}
+
+func commands() map[string]command {
+	return map[string]command{
+		"ls":     {"ls [-l] [path]", runLs},
+		"tree":   {"tree [-depth n] [path]", runTree},
+		"put":    {"put [-r] [-p] [-q] [-tags a,b] [-conflict policy] [-wait] local... remote-dir", runPut},
+		"get":    {"get [-q] remote [local]", runGet},
+		"mv":     {"mv [-conflict policy] source destination", runMv},
+		"cp":     {"cp [-conflict policy] source destination", runCp},
+		"rm":     {"rm [-r] path...", runRm},
+		"mkdir":  {"mkdir [-p] path...", runMkdir},
+		"stat":   {"stat path", runStat},
+		"status": {"status [-wait] id", runStatus},
+		"sync":   {"sync [-n] [-delete] [-checksum] [-q] [-wait] local-dir remote-dir", runSync},
+		"key":    {"key ls | key add [-admin] name | key revoke id", runKey},
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dss [-profile name] [-url url] command [arguments]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+
+	all := commands()
+	names := make([]string, 0, len(all))
+
+	for name := range all {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  dss", all[name].usage)
+	}
+}
+
+func main() {
+	profileName := flag.String("profile", "", "the profile of the profile file to use")
+	url := flag.String("url", "", "the url of the server, overrides the profile")
+
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, found := commands()[flag.Arg(0)]
+	if !found {
+		fmt.Fprintf(os.Stderr, "dss: unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	settings, err := loadProfile(*profileName)
+	if err != nil {
+		fail(err)
+	}
+
+	if *url != "" {
+		settings.URL = *url
+	}
+
+	c, err := client.New(settings.URL, client.WithToken(settings.Token))
+	if err != nil {
+		fail(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err = cmd.run(ctx, c, flag.Args()[1:]); err != nil {
+		stop()
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "dss:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	barWidth = 30
+	// redrawInterval throttles the redraws of a progress bar.
+	redrawInterval = 100 * time.Millisecond
+)
+
+// progressBar draws the progress of a transfer on a single line.
+type progressBar struct {
+	out   io.Writer
+	name  string
+	total int64
+	start int64
+	drawn time.Time
+}
+
+// newProgressBar tracks a transfer of total bytes, start bytes of which were
+// already transferred. A negative total draws a counter instead of a bar.
+func newProgressBar(out io.Writer, name string, total int64, start int64) *progressBar {
+	return &progressBar{out: out, name: name, total: total, start: start}
+}
+
+// update is the progress callback of a transfer.
+func (p *progressBar) update(sent int64) {
+	if p == nil || time.Since(p.drawn) < redrawInterval {
+		return
+	}
+
+	p.draw(p.start + sent)
+}
+
+// done draws the final state and ends the line.
+func (p *progressBar) done(sent int64) {
+	if p == nil {
+		return
+	}
+
+	p.draw(p.start + sent)
+	fmt.Fprintln(p.out)
+}
+
+func (p *progressBar) draw(current int64) {
+	p.drawn = time.Now()
+
+	if p.total <= 0 {
+		fmt.Fprintf(p.out, "\r%s %s", p.name, humanize.IBytes(uint64(current)))
+		return
+	}
+
+	if current > p.total {
+		current = p.total
+	}
+
+	filled := int(current * barWidth / p.total)
+
+	fmt.Fprintf(p.out, "\r%s [%s%s] %3d%% %s/%s", p.name, strings.Repeat("=", filled),
+		strings.Repeat(" ", barWidth-filled), current*100/p.total, humanize.IBytes(uint64(current)),
+		humanize.IBytes(uint64(p.total)))
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	reader   io.Reader
+	progress func(int64)
+	read     int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.reader.Read(b)
+	c.read += int64(n)
+
+	if c.progress != nil {
+		c.progress(c.read)
+	}
+
+	return n, err
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"dss-main/client"
+)
+
+// localFile is a regular file of the tree being synced.
+type localFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// syncPlan is what a sync has to do to make the remote tree match the
+// local one, paths are relative to the roots of both trees.
+type syncPlan struct {
+	uploads   []syncUpload
+	deletes   []client.ManifestEntry
+	unchanged int
+}
+
+type syncUpload struct {
+	relative string
+	file     localFile
+	reason   string
+}
+
+type syncer struct {
+	checksum bool
+	delete   bool
+}
+
+func runSync(ctx context.Context, c *client.Client, args []string) error {
+	set := flags("sync")
+	dryRun := set.Bool("n", false, "only print what would be uploaded and deleted")
+	deleteExtra := set.Bool("delete", false, "delete remote files that don't exist locally")
+	checksum := set.Bool("checksum", false, "compare the sha256 of files even when size and mtime match")
+	quiet := set.Bool("q", false, "don't draw progress bars")
+	wait := set.Bool("wait", false, "wait until every fragment of the uploads is stored")
+	_ = set.Parse(args)
+
+	if set.NArg() != 2 {
+		set.Usage()
+		os.Exit(2)
+	}
+
+	localDir, remoteDir := set.Arg(0), remotePath(set.Arg(1))
+
+	files, dirs, err := walkLocal(localDir)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := c.Manifest(ctx, remoteDir)
+	if errors.Is(err, client.ErrNotFound) {
+		manifest = &client.Manifest{Path: remoteDir}
+	} else if err != nil {
+		return err
+	}
+
+	s := syncer{checksum: *checksum, delete: *deleteExtra}
+
+	plan, err := s.plan(files, dirs, manifest.Files)
+	if err != nil {
+		return err
+	}
+
+	prefix := ""
+	if *dryRun {
+		prefix = "(dry run) "
+	}
+
+	for _, entry := range plan.deletes {
+		fmt.Printf("%sdelete %s\n", prefix, path.Join(remoteDir, entry.Path))
+
+		if *dryRun {
+			continue
+		}
+
+		if err = c.Delete(ctx, entry.ID, entry.IsDirectory); err != nil {
+			return fmt.Errorf("%s: %w", entry.Path, err)
+		}
+	}
+
+	up := &uploader{client: c, quiet: *quiet || *dryRun, wait: *wait, opts: client.UploadOptions{
+		Parents:  true,
+		Conflict: client.ConflictOverwrite,
+	}}
+
+	for _, upload := range plan.uploads {
+		remote := path.Join(remoteDir, upload.relative)
+
+		if *dryRun {
+			fmt.Printf("%supload %s (%s)\n", prefix, remote, upload.reason)
+			continue
+		}
+
+		opts := up.opts
+		opts.ModTime = upload.file.modTime
+
+		if err = up.put(ctx, upload.file.path, remote, upload.file.size, opts); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%s%d uploaded, %d deleted, %d unchanged\n", prefix, len(plan.uploads),
+		len(plan.deletes), plan.unchanged)
+
+	return nil
+}
+
+// walkLocal collects the regular files and the directories under root by
+// their slash separated path relative to root.
+func walkLocal(root string) (map[string]localFile, map[string]bool, error) {
+	files := map[string]localFile{}
+	dirs := map[string]bool{}
+
+	err := filepath.WalkDir(root, func(local string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(root, local)
+		if err != nil || relative == "." {
+			return err
+		}
+
+		relative = filepath.ToSlash(relative)
+
+		switch {
+		case entry.IsDir():
+			dirs[relative] = true
+		case entry.Type().IsRegular():
+			info, infoErr := entry.Info()
+			if infoErr != nil {
+				return infoErr
+			}
+
+			files[relative] = localFile{path: local, size: info.Size(), modTime: info.ModTime()}
+		}
+
+		return nil
+	})
+
+	return files, dirs, err
+}
+
+// plan compares the local tree to the manifest of the remote one. An entry
+// whose type differs on both sides is only replaced when deleting is on.
+func (s syncer) plan(files map[string]localFile, dirs map[string]bool, remote []client.ManifestEntry,
+) (*syncPlan, error) {
+	plan := &syncPlan{}
+	remoteByPath := map[string]client.ManifestEntry{}
+
+	// the manifest lists parents before their children, so a deleted
+	// directory is always seen before anything under it.
+	deleted := []string{}
+
+	for _, entry := range remote {
+		remoteByPath[entry.Path] = entry
+
+		if underAny(entry.Path, deleted) {
+			continue
+		}
+
+		_, isFile := files[entry.Path]
+		isDir := dirs[entry.Path]
+
+		extra := !isFile && !isDir
+		mismatch := (isFile && entry.IsDirectory) || (isDir && !entry.IsDirectory)
+
+		if mismatch && !s.delete {
+			return nil, fmt.Errorf("%s is a directory on one side and a file on the other, "+
+				"use -delete to replace the remote one", entry.Path)
+		}
+
+		if (extra && s.delete) || mismatch {
+			plan.deletes = append(plan.deletes, entry)
+			deleted = append(deleted, entry.Path)
+		}
+	}
+
+	relatives := make([]string, 0, len(files))
+	for relative := range files {
+		relatives = append(relatives, relative)
+	}
+
+	sort.Strings(relatives)
+
+	for _, relative := range relatives {
+		file := files[relative]
+
+		entry, exists := remoteByPath[relative]
+		if !exists || underAny(relative, deleted) {
+			plan.uploads = append(plan.uploads, syncUpload{relative: relative, file: file, reason: "new"})
+			continue
+		}
+
+		reason, err := s.changed(file, entry)
+		if err != nil {
+			return nil, err
+		}
+
+		if reason == "" {
+			plan.unchanged++
+			continue
+		}
+
+		plan.uploads = append(plan.uploads, syncUpload{relative: relative, file: file, reason: reason})
+	}
+
+	return plan, nil
+}
+
+// changed explains why a local file differs from its remote copy, it is
+// empty when they are the same. Matching sizes and mtimes are trusted
+// unless checksums were asked for, otherwise the checksums decide. A file
+// whose checksum matches keeps its remote mtime, the api can only set it by
+// uploading the file again, so every later sync hashes that file once more.
+func (s syncer) changed(file localFile, entry client.ManifestEntry) (string, error) {
+	switch {
+	case entry.IsProcessing:
+		return "unfinished upload", nil
+	case entry.Bytes != file.size:
+		return "size changed", nil
+	case !s.checksum && entry.ModTime == file.modTime.Unix():
+		return "", nil
+	case entry.Checksum == "":
+		return "no remote checksum", nil
+	}
+
+	sum, err := fileChecksum(file.path)
+	if err != nil {
+		return "", err
+	}
+
+	if sum != entry.Checksum {
+		return "content changed", nil
+	}
+
+	return "", nil
+}
+
+// underAny reports whether p is one of dirs or is under one of them.
+func underAny(p string, dirs []string) bool {
+	for _, dir := range dirs {
+		if p == dir || strings.HasPrefix(p, dir+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func fileChecksum(local string) (string, error) {
+	file, err := os.Open(local)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("%s: %w", local, err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dss-main/client"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_plan(t *testing.T) {
+	// remote entries leave mtime at zero, so unchanged files match on size.
+	file := localFile{size: 1, modTime: time.Unix(0, 0)}
+
+	tests := []struct {
+		name     string
+		delete   bool
+		files    []string
+		dirs     []string
+		remote   []client.ManifestEntry
+		uploads  []string
+		deletes  []string
+		mismatch bool
+	}{
+		{
+			name:    "new file",
+			files:   []string{"a", "b"},
+			remote:  []client.ManifestEntry{{Path: "a", Bytes: 1}},
+			uploads: []string{"b"},
+		},
+		{
+			name:   "extra remote file is kept",
+			remote: []client.ManifestEntry{{Path: "a", Bytes: 1}},
+		},
+		{
+			name:    "extra remote file is deleted",
+			delete:  true,
+			remote:  []client.ManifestEntry{{Path: "a", Bytes: 1}},
+			deletes: []string{"a"},
+		},
+		{
+			name:    "nothing under a deleted directory is deleted again",
+			delete:  true,
+			remote:  []client.ManifestEntry{{Path: "a", IsDirectory: true}, {Path: "a/b"}, {Path: "a/c/d"}},
+			deletes: []string{"a"},
+		},
+		{
+			name:     "local file over a remote directory",
+			files:    []string{"a"},
+			remote:   []client.ManifestEntry{{Path: "a", IsDirectory: true}},
+			mismatch: true,
+		},
+		{
+			name:     "local directory over a remote file",
+			dirs:     []string{"a"},
+			remote:   []client.ManifestEntry{{Path: "a", Bytes: 1}},
+			mismatch: true,
+		},
+		{
+			name:    "remote directory replaced by a file",
+			delete:  true,
+			files:   []string{"a"},
+			remote:  []client.ManifestEntry{{Path: "a", IsDirectory: true}, {Path: "a/b", Bytes: 1}},
+			uploads: []string{"a"},
+			deletes: []string{"a"},
+		},
+		{
+			name:    "remote file replaced by a directory",
+			delete:  true,
+			files:   []string{"a/b"},
+			dirs:    []string{"a"},
+			remote:  []client.ManifestEntry{{Path: "a", Bytes: 1}},
+			uploads: []string{"a/b"},
+			deletes: []string{"a"},
+		},
+		{
+			name:    "file under a deleted directory is uploaded again",
+			delete:  true,
+			files:   []string{"a/b/c"},
+			dirs:    []string{"a", "a/b"},
+			remote:  []client.ManifestEntry{{Path: "a", IsDirectory: true}, {Path: "a/b", Bytes: 1}},
+			uploads: []string{"a/b/c"},
+			deletes: []string{"a/b"},
+		},
+	}
+
+	for _, test := range tests {
+		files := map[string]localFile{}
+		for _, relative := range test.files {
+			files[relative] = file
+		}
+
+		dirs := map[string]bool{}
+		for _, dir := range test.dirs {
+			dirs[dir] = true
+		}
+
+		plan, err := syncer{delete: test.delete}.plan(files, dirs, test.remote)
+		if test.mismatch {
+			require.Error(t, err, test.name)
+			continue
+		}
+
+		require.NoError(t, err, test.name)
+
+		var uploads, deletes []string
+		for _, upload := range plan.uploads {
+			uploads = append(uploads, upload.relative)
+		}
+
+		for _, entry := range plan.deletes {
+			deletes = append(deletes, entry.Path)
+		}
+
+		require.Equal(t, test.uploads, uploads, test.name)
+		require.Equal(t, test.deletes, deletes, test.name)
+	}
+}
+
+func Test_changed(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(local, []byte("content"), 0o600))
+
+	// sha256 of "content".
+	const sum = "ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73"
+
+	modTime := time.Unix(1700000000, 0)
+	file := localFile{path: local, size: 7, modTime: modTime}
+
+	tests := []struct {
+		name     string
+		checksum bool
+		entry    client.ManifestEntry
+		reason   string
+	}{
+		{
+			name:   "unfinished upload",
+			entry:  client.ManifestEntry{Bytes: 7, IsProcessing: true, ModTime: modTime.Unix(), Checksum: sum},
+			reason: "unfinished upload",
+		},
+		{
+			name:   "size changed",
+			entry:  client.ManifestEntry{Bytes: 8, ModTime: modTime.Unix(), Checksum: sum},
+			reason: "size changed",
+		},
+		{
+			name:  "size and mtime match",
+			entry: client.ManifestEntry{Bytes: 7, ModTime: modTime.Unix(), Checksum: "other"},
+		},
+		{
+			name:     "checksum asked for",
+			checksum: true,
+			entry:    client.ManifestEntry{Bytes: 7, ModTime: modTime.Unix(), Checksum: "other"},
+			reason:   "content changed",
+		},
+		{
+			name:   "mtime differs without a remote checksum",
+			entry:  client.ManifestEntry{Bytes: 7, ModTime: modTime.Unix() + 1},
+			reason: "no remote checksum",
+		},
+		{
+			name:  "mtime differs and checksum matches",
+			entry: client.ManifestEntry{Bytes: 7, ModTime: modTime.Unix() + 1, Checksum: sum},
+		},
+		{
+			name:   "mtime differs and checksum differs",
+			entry:  client.ManifestEntry{Bytes: 7, ModTime: modTime.Unix() + 1, Checksum: "other"},
+			reason: "content changed",
+		},
+	}
+
+	for _, test := range tests {
+		reason, err := syncer{checksum: test.checksum}.changed(file, test.entry)
+		require.NoError(t, err, test.name)
+		require.Equal(t, test.reason, reason, test.name)
+	}
+}
@@ -6,10 +6,25 @@ import (
 	"github.com/yakiroren/dss-common/db"
 )
 
+// Config is read from the environment. AUTH has no default, the server
+// refuses to start until authentication is turned on or explicitly off.
 type Config struct {
-	Port         string    `env:",required,notEmpty"`
-	LogLevel     log.Level `env:",required,notEmpty"`
-	FragmentSize int64     `env:",required,notEmpty"`
-	Publisher    rabbit.Config
-	Mongo        db.MongoConfig
+	Port          string    `env:",required,notEmpty"`
+	LogLevel      log.Level `env:",required,notEmpty"`
+	FragmentSize  int64     `env:",required,notEmpty"`
+	BatchLimit    int       `envDefault:"500"`
+	DavPort       string
+	S3Port        string            `env:"S3_PORT"`
+	S3Region      string            `env:"S3_REGION" envDefault:"us-east-1"`
+	S3Credentials map[string]string `env:"S3_CREDENTIALS"`
+	GrpcPort      string
+	Auth          bool     `env:",required"`
+	AuthAdminKey  string   `env:"AUTH_ADMIN_KEY"`
+	AuthJWKSFile  string   `env:"AUTH_JWKS_FILE"`
+	AuthIssuer    string   `env:"AUTH_ISSUER"`
+	AuthAudience  string   `env:"AUTH_AUDIENCE"`
+	PublicBrowse  bool     `env:"PUBLIC_BROWSE"`
+	CORSOrigins   []string `env:"CORS_ORIGINS"`
+	Publisher     rabbit.Config
+	Mongo         db.MongoConfig
 }
@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/yakiroren/dss-common/db"
+	"golang.org/x/text/unicode/norm"
 )
 
 type FS struct {
@@ -21,6 +22,9 @@ func (fs FS) Open(path string) (http.File, error) {
 		path = strings.TrimSuffix(path, "/")
 	}
 
+	// names are stored NFC normalized.
+	path = norm.NFC.String(path)
+
 	metadata, found := fs.datastore.GetMetadataByPath(context.Background(), path)
 	if !found {
 		return nil, errors.New("file not found")
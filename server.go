@@ -3,8 +3,14 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
 
+	"dss-main/catalog"
 	"dss-main/config"
+	"dss-main/dsspb"
 	"dss-main/fs"
 	"dss-main/server"
 
@@ -16,11 +22,16 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/filesystem"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	log "github.com/sirupsen/logrus"
 	"github.com/yakiroren/dss-common/db"
+	"google.golang.org/grpc"
 )
 
-const maxAge = 3600
+const (
+	maxAge            = 3600
+	readHeaderTimeout = 10 * time.Second
+)
 
 func main() {
 	conf := &config.Config{}
@@ -36,41 +47,100 @@ func main() {
 		log.Fatal("could not connect to mongodb:", err)
 	}
 
-	srv, err := server.NewServer(conf, store)
+	cat, err := catalog.New(store)
+	if err != nil {
+		log.Fatal("could not create catalog:", err)
+	}
+
+	srv, err := server.NewServer(conf, store, cat)
 	if err != nil {
 		log.Fatal("server couldn't be created", err)
 	}
 
-	const limit = units.GiB * 5
+	spec, err := server.LoadOpenAPI()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	const (
+		limit     = units.GiB * 5
+		formLimit = units.MiB * 16
+	)
 
 	app := fiber.New(fiber.Config{
 		BodyLimit:             limit,
 		ReduceMemoryUsage:     true,
 		DisableStartupMessage: true,
 		UnescapePath:          true,
+		StreamRequestBody:     true,
+		ErrorHandler:          server.ErrorHandler,
 	})
 
 	app.Use(recover.New())
-	app.Use(logger.New())
-	app.Use(cors.New())
+	app.Use(requestid.New())
+	app.Use(logger.New(logger.Config{
+		Format: "${time} | ${status} | ${latency} | ${ip} | ${method} | ${path} | ${respHeader:X-Request-ID} | ${error}\n",
+	}))
+	app.Use(server.LimitBody(limit, formLimit, uploadRoute))
+
+	if origins := corsOrigins(conf); len(origins) > 0 {
+		app.Use(cors.New(cors.Config{
+			AllowOrigins:  strings.Join(origins, ","),
+			AllowHeaders:  "Authorization, Content-Type, Range",
+			ExposeHeaders: "Content-Disposition, Content-Range, X-Request-ID, " + server.NextCursorHeader,
+		}))
+	}
 
 	api := app.Group("/api")
+	api.Get("/openapi.json", spec.Spec)
 
 	v1 := api.Group("/v1")
+	v1.Use(srv.Authenticate)
+	v1.Use(spec.Validate)
 
 	v1.Post("/upload", srv.Upload)
+	v1.Put("/upload/*", srv.StreamUpload)
+	v1.Post("/import", srv.Import)
 	v1.Post("/mkdir", srv.Mkdir)
 	v1.Post("/rename/:id", srv.Rename)
 	v1.Post("/move/:id", srv.Move)
+	v1.Post("/copy/:id", srv.Copy)
 	v1.Delete("/delete/:id", srv.Delete)
+	v1.Post("/batch", srv.Batch)
 	v1.Get("/status/:id", srv.Status)
+	v1.Get("/download/:id", srv.Download)
+	v1.Get("/jobs/:id", srv.JobStatus)
 	v1.Get("/dir/*", srv.Dir)
+	v1.Get("/tree/*", srv.Tree)
+	v1.Get("/du/*", srv.DiskUsage)
+	v1.Get("/manifest/*", srv.Manifest)
+	v1.Get("/archive/*", srv.Archive)
+	v1.Get("/search", srv.Search)
+	v1.Get("/tags", srv.ListTags)
+	v1.Post("/tags/bulk", srv.BulkTag)
+	v1.Post("/tags/:id", srv.AddTags)
+	v1.Put("/tags/:id", srv.ReplaceTags)
+	v1.Delete("/tags/:id", srv.RemoveTags)
+	v1.Post("/versioning/:id", srv.SetVersioning)
+	v1.Get("/versions/:id", srv.ListVersions)
+	v1.Delete("/versions/:id", srv.PruneVersions)
+	v1.Get("/versions/:id/:version", srv.DownloadVersion)
+	v1.Post("/versions/:id/:version/restore", srv.RestoreVersion)
+	v1.Get("/keys", srv.RequireAdmin, srv.ListKeys)
+	v1.Post("/keys", srv.RequireAdmin, srv.IssueKey)
+	v1.Delete("/keys/:id", srv.RequireAdmin, srv.RevokeKey)
 
 	dfs, err := fs.New(store)
 	if err != nil {
 		log.Error(err)
 	}
 
+	if !conf.Auth {
+		log.Warn("authentication is disabled by AUTH=false, anyone reaching the server can read and change every file")
+	} else if !conf.PublicBrowse {
+		app.Use(srv.AuthenticateBrowse)
+	}
+
 	app.Use(
 		filesystem.New(filesystem.Config{
 			Root:   dfs,
@@ -84,10 +154,78 @@ func main() {
 		createRootDir(srv)
 	}
 
+	if conf.DavPort != "" {
+		go serveHTTP("webdav", conf.DavPort, srv.WebDAV("/dav"))
+	}
+
+	if conf.S3Port != "" {
+		if len(conf.S3Credentials) == 0 {
+			log.Fatal("the s3 gateway needs S3_CREDENTIALS")
+		}
+
+		go serveHTTP("s3", conf.S3Port, srv.S3(conf.S3Region, conf.S3Credentials))
+	}
+
+	if conf.GrpcPort != "" {
+		go serveGRPC(conf.GrpcPort, srv.GRPC(), srv.GRPCOptions()...)
+	}
+
 	serverAddr := fmt.Sprintf(":%s", conf.Port)
 	log.Error(app.Listen(serverAddr))
 }
 
+// corsOrigins returns the origins browsers may call the api from. Without
+// CORS_ORIGINS an open server allows every origin, while a server with
+// authentication allows none so other sites can't use a browser's
+// credentials.
+func corsOrigins(conf *config.Config) []string {
+	if len(conf.CORSOrigins) > 0 || conf.Auth {
+		return conf.CORSOrigins
+	}
+
+	return []string{"*"}
+}
+
+// uploadRoute reports whether a request is an upload, whose body is
+// streamed to the handler instead of being read into memory.
+func uploadRoute(ctx *fiber.Ctx) bool {
+	switch ctx.Method() {
+	case fiber.MethodPut:
+		return strings.HasPrefix(ctx.Path(), "/api/v1/upload/")
+	case fiber.MethodPost:
+		return ctx.Path() == "/api/v1/upload"
+	}
+
+	return false
+}
+
+// serveHTTP runs a protocol gateway on its own net/http listener, the fiber
+// adaptor would hold whole request and response bodies in memory.
+func serveHTTP(name string, port string, handler http.Handler) {
+	httpServer := &http.Server{
+		Addr:              fmt.Sprintf(":%s", port),
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	log.Info("serving ", name, " on ", httpServer.Addr)
+	log.Error(httpServer.ListenAndServe())
+}
+
+func serveGRPC(port string, service dsspb.StorageServer, opts ...grpc.ServerOption) {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	grpcServer := grpc.NewServer(opts...)
+	dsspb.RegisterStorageServer(grpcServer, service)
+
+	log.Info("serving grpc on ", listener.Addr())
+	log.Error(grpcServer.Serve(listener))
+}
+
 func createRootDir(srv *server.Server) {
 	if err := srv.CreateDir(context.Background(), "/", "/"); err != nil {
 		log.Fatal(err)
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/yakiroren/dss-common/models"
+)
+
+const (
+	formatZip   = "zip"
+	formatTarGz = "tar.gz"
+)
+
+// archiveWriter adds the entries of a directory to an archive, name is the
+// path of the entry inside the archive.
+type archiveWriter interface {
+	Dir(name string, metadata models.FileMetadata) error
+	File(name string, metadata models.FileMetadata, content io.Reader) error
+	Close() error
+}
+
+// Archive streams a directory as a zip or tar.gz composed on the fly from
+// the fragments of its files, nothing is staged on disk.
+func (s *Server) Archive(ctx *fiber.Ctx) error {
+	dir := wildcardPath(ctx)
+
+	metadata, exists := s.datastore.GetMetadataByPath(ctx.Context(), dir)
+	if !exists {
+		return notFoundError("directory not found")
+	}
+
+	if !metadata.IsDirectory {
+		return invalidPathError("the provided path is not a directory")
+	}
+
+	format := ctx.Query("format", formatZip)
+	if format != formatZip && format != formatTarGz {
+		return fiber.NewError(http.StatusBadRequest, "format must be zip or tar.gz")
+	}
+
+	name := metadata.FileName
+	if isRoot(*metadata) {
+		name = "root"
+	}
+
+	ctx.Attachment(name + "." + format)
+
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		var archive archiveWriter = newZipArchive(w)
+		if format == formatTarGz {
+			archive = newTarArchive(w)
+		}
+
+		// the handler has returned by now, the request context can't be used.
+		if err := s.walkArchive(context.Background(), archive, dir, name); err != nil {
+			// without its trailer the truncated archive fails to parse, so the
+			// client can tell it apart from a complete one.
+			log.Error("archive of ", dir, " failed: ", err)
+			return
+		}
+
+		if err := archive.Close(); err != nil {
+			log.Error(err)
+		}
+
+		if err := w.Flush(); err != nil {
+			log.Error(err)
+		}
+	})
+
+	return nil
+}
+
+func (s *Server) walkArchive(ctx context.Context, archive archiveWriter, dir string, prefix string) error {
+	files, err := s.datastore.ListFiles(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if isRoot(file) {
+			continue
+		}
+
+		name := path.Join(prefix, file.FileName)
+
+		if file.IsDirectory {
+			if err = archive.Dir(name, file); err != nil {
+				return err
+			}
+
+			if err = s.walkArchive(ctx, archive, filepath.Join(dir, file.FileName), name); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if isProcessing(&file) {
+			log.Warn("skipping ", name, " in archive, it is still being uploaded")
+			continue
+		}
+
+		if err = s.archiveFile(ctx, archive, name, file); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) archiveFile(ctx context.Context, archive archiveWriter, name string, file models.FileMetadata) error {
+	content, err := s.storage.ReadFragments(ctx, file.Fragments)
+	if err != nil {
+		return err
+	}
+
+	defer func(content io.ReadCloser) {
+		if closeErr := content.Close(); closeErr != nil {
+			log.Error(closeErr)
+		}
+	}(content)
+
+	return archive.File(name, file, content)
+}
+
+type zipArchive struct {
+	writer *zip.Writer
+}
+
+func newZipArchive(w io.Writer) *zipArchive {
+	return &zipArchive{writer: zip.NewWriter(w)}
+}
+
+func (a *zipArchive) Dir(name string, metadata models.FileMetadata) error {
+	_, err := a.writer.CreateHeader(&zip.FileHeader{
+		Name:     name + "/",
+		Modified: time.Unix(metadata.CreationTime, 0),
+	})
+	return err
+}
+
+func (a *zipArchive) File(name string, metadata models.FileMetadata, content io.Reader) error {
+	w, err := a.writer.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Unix(metadata.CreationTime, 0),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, content)
+	return err
+}
+
+func (a *zipArchive) Close() error {
+	return a.writer.Close()
+}
+
+type tarArchive struct {
+	gzip   *gzip.Writer
+	writer *tar.Writer
+}
+
+func newTarArchive(w io.Writer) *tarArchive {
+	compressed := gzip.NewWriter(w)
+	return &tarArchive{gzip: compressed, writer: tar.NewWriter(compressed)}
+}
+
+func (a *tarArchive) Dir(name string, metadata models.FileMetadata) error {
+	return a.writer.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0o755,
+		ModTime:  time.Unix(metadata.CreationTime, 0),
+	})
+}
+
+func (a *tarArchive) File(name string, metadata models.FileMetadata, content io.Reader) error {
+	err := a.writer.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o644,
+		Size:     metadata.FileSize,
+		ModTime:  time.Unix(metadata.CreationTime, 0),
+	})
+	if err != nil {
+		return err
+	}
+
+	// the header promised FileSize bytes, anything else corrupts the archive.
+	_, err = io.CopyN(a.writer, content, metadata.FileSize)
+	return err
+}
+
+func (a *tarArchive) Close() error {
+	if err := a.writer.Close(); err != nil {
+		return err
+	}
+
+	return a.gzip.Close()
+}
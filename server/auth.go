@@ -0,0 +1,276 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"dss-main/catalog"
+	"dss-main/config"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// apiKeyPrefix starts the secret of every api key, it tells them apart
+	// from jwts.
+	apiKeyPrefix = "dss_"
+	apiKeyBytes  = 32
+	// adminScope in the scope claim of a jwt grants the admin endpoints.
+	adminScope = "dss:admin"
+	// jwtLeeway is how far the clocks of the issuer and the server may drift.
+	jwtLeeway = time.Minute
+
+	principalKey = "principal"
+)
+
+var errMissingCredentials = unauthorizedError("an api key or a bearer token is required")
+
+// Principal is who a request was authenticated as.
+type Principal struct {
+	Subject string
+	Admin   bool
+}
+
+// authenticator checks the credentials of requests against the api keys of
+// the catalog, the admin key of the configuration and the keys of a JWKS.
+type authenticator struct {
+	catalog  *catalog.Catalog
+	adminKey []byte
+	jwks     *jose.JSONWebKeySet
+	issuer   string
+	audience string
+	now      func() time.Time
+}
+
+// newAuthenticator returns nil when authentication is disabled.
+func newAuthenticator(conf *config.Config, cat *catalog.Catalog) (*authenticator, error) {
+	if !conf.Auth {
+		return nil, nil
+	}
+
+	if conf.AuthAdminKey == "" && conf.AuthJWKSFile == "" {
+		return nil, errors.New("authentication needs AUTH_ADMIN_KEY or AUTH_JWKS_FILE")
+	}
+
+	auth := &authenticator{catalog: cat, issuer: conf.AuthIssuer, audience: conf.AuthAudience, now: time.Now}
+
+	if conf.AuthAdminKey != "" {
+		hash := sha256.Sum256([]byte(conf.AuthAdminKey))
+		auth.adminKey = hash[:]
+	}
+
+	if conf.AuthJWKSFile != "" {
+		jwks, err := loadJWKS(conf.AuthJWKSFile)
+		if err != nil {
+			return nil, err
+		}
+
+		auth.jwks = jwks
+	}
+
+	return auth, nil
+}
+
+// loadJWKS reads a JSON Web Key Set, private keys are reduced to their
+// public half since they are only used to verify signatures.
+func loadJWKS(path string) (*jose.JSONWebKeySet, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	jwks := &jose.JSONWebKeySet{}
+	if err = json.Unmarshal(content, jwks); err != nil {
+		return nil, fmt.Errorf("reading the jwks %s: %w", path, err)
+	}
+
+	if len(jwks.Keys) == 0 {
+		return nil, fmt.Errorf("the jwks %s has no keys", path)
+	}
+
+	for i, key := range jwks.Keys {
+		if _, symmetric := key.Key.([]byte); !symmetric && !key.IsPublic() {
+			jwks.Keys[i] = key.Public()
+		}
+	}
+
+	return jwks, nil
+}
+
+// authenticate checks the value of an Authorization header. Bearer holds an
+// api key or a jwt, Basic is accepted with either one as the password for
+// browsers and WebDAV clients.
+func (a *authenticator) authenticate(ctx context.Context, authorization string) (*Principal, error) {
+	scheme, credentials, _ := strings.Cut(strings.TrimSpace(authorization), " ")
+	credentials = strings.TrimSpace(credentials)
+
+	switch strings.ToLower(scheme) {
+	case "bearer":
+	case "basic":
+		decoded, err := base64.StdEncoding.DecodeString(credentials)
+		if err != nil {
+			return nil, unauthorizedError("the basic credentials are not valid")
+		}
+
+		_, credentials, _ = strings.Cut(string(decoded), ":")
+	default:
+		return nil, errMissingCredentials
+	}
+
+	if credentials == "" {
+		return nil, errMissingCredentials
+	}
+
+	hash := sha256.Sum256([]byte(credentials))
+	if a.adminKey != nil && subtle.ConstantTimeCompare(hash[:], a.adminKey) == 1 {
+		return &Principal{Subject: "admin", Admin: true}, nil
+	}
+
+	if strings.HasPrefix(credentials, apiKeyPrefix) {
+		return a.apiKey(ctx, hex.EncodeToString(hash[:]))
+	}
+
+	if a.jwks != nil {
+		return a.token(credentials)
+	}
+
+	return nil, unauthorizedError("the credentials are not valid")
+}
+
+func (a *authenticator) apiKey(ctx context.Context, hash string) (*Principal, error) {
+	key, err := a.catalog.KeyByHash(ctx, hash)
+	if errors.Is(err, catalog.ErrKeyNotFound) {
+		return nil, unauthorizedError("the api key is not valid")
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &Principal{Subject: "key:" + key.ID.Hex(), Admin: key.Admin}, nil
+}
+
+// token verifies a jwt with the key of the JWKS its kid names, or with any
+// key when it names none. The token must expire.
+func (a *authenticator) token(raw string) (*Principal, error) {
+	invalid := unauthorizedError("the bearer token is not valid")
+
+	token, err := jwt.ParseSigned(raw)
+	if err != nil || len(token.Headers) != 1 {
+		return nil, invalid
+	}
+
+	keys := a.jwks.Keys
+	if kid := token.Headers[0].KeyID; kid != "" {
+		keys = a.jwks.Key(kid)
+	}
+
+	var (
+		claims jwt.Claims
+		extra  struct {
+			Scope string `json:"scope"`
+		}
+		verified bool
+	)
+
+	for _, key := range keys {
+		if key.Algorithm != "" && key.Algorithm != token.Headers[0].Algorithm {
+			continue
+		}
+
+		if token.Claims(key.Key, &claims, &extra) == nil {
+			verified = true
+			break
+		}
+	}
+
+	if !verified || claims.Expiry == nil {
+		return nil, invalid
+	}
+
+	expected := jwt.Expected{Issuer: a.issuer, Time: a.now()}
+	if a.audience != "" {
+		expected.Audience = jwt.Audience{a.audience}
+	}
+
+	if err = claims.ValidateWithLeeway(expected, jwtLeeway); err != nil {
+		return nil, unauthorizedError("the bearer token is not valid: " + err.Error())
+	}
+
+	principal := &Principal{Subject: claims.Subject}
+
+	for _, scope := range strings.Fields(extra.Scope) {
+		if scope == adminScope {
+			principal.Admin = true
+		}
+	}
+
+	return principal, nil
+}
+
+// newAPIKey returns a new secret and the hash it is stored under.
+func newAPIKey() (string, string, error) {
+	random := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", "", err
+	}
+
+	secret := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(random)
+	hash := sha256.Sum256([]byte(secret))
+
+	return secret, hex.EncodeToString(hash[:]), nil
+}
+
+// Authenticate lets authenticated requests through to the rest api, it
+// does nothing when authentication is disabled.
+func (s *Server) Authenticate(ctx *fiber.Ctx) error {
+	return s.authenticateRequest(ctx, `Bearer realm="dss"`)
+}
+
+// AuthenticateBrowse guards the browse filesystem, browsers prompt for
+// Basic credentials.
+func (s *Server) AuthenticateBrowse(ctx *fiber.Ctx) error {
+	return s.authenticateRequest(ctx, `Basic realm="dss"`)
+}
+
+func (s *Server) authenticateRequest(ctx *fiber.Ctx, challenge string) error {
+	if s.auth == nil {
+		return ctx.Next()
+	}
+
+	principal, err := s.auth.authenticate(ctx.Context(), ctx.Get(fiber.HeaderAuthorization))
+	if err != nil {
+		ctx.Set(fiber.HeaderWWWAuthenticate, challenge)
+		return err
+	}
+
+	ctx.Locals(principalKey, principal)
+
+	return ctx.Next()
+}
+
+// RequireAdmin lets only admins through. The admin endpoints are closed
+// when authentication is disabled, keys issued then would let anyone in
+// once it is enabled.
+func (s *Server) RequireAdmin(ctx *fiber.Ctx) error {
+	if s.auth == nil {
+		return forbiddenError("authentication is disabled")
+	}
+
+	principal, ok := ctx.Locals(principalKey).(*Principal)
+	if !ok || !principal.Admin {
+		return forbiddenError("only admins can manage api keys")
+	}
+
+	return ctx.Next()
+}
@@ -0,0 +1,142 @@
+package server_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dss-main/config"
+	"dss-main/server"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAdminKey = "correct horse battery staple"
+	testIssuer   = "https://issuer.example"
+)
+
+func newSigner(t *testing.T, kid string) (jose.Signer, jose.JSONWebKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", kid))
+	require.NoError(t, err)
+
+	return signer, jose.JSONWebKey{Key: &key.PublicKey, KeyID: kid, Algorithm: string(jose.RS256), Use: "sig"}
+}
+
+func signToken(t *testing.T, signer jose.Signer, claims jwt.Claims, scope string) string {
+	token, err := jwt.Signed(signer).Claims(claims).Claims(map[string]any{"scope": scope}).CompactSerialize()
+	require.NoError(t, err)
+
+	return token
+}
+
+func Test_authenticate(t *testing.T) {
+	signer, public := newSigner(t, "main")
+	stranger, _ := newSigner(t, "main")
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	content, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{public}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(jwksFile, content, 0o600))
+
+	srv, err := server.NewServer(&config.Config{
+		Auth:         true,
+		AuthAdminKey: testAdminKey,
+		AuthJWKSFile: jwksFile,
+		AuthIssuer:   testIssuer,
+	}, nil, nil)
+	require.NoError(t, err)
+
+	app := fiber.New(fiber.Config{ErrorHandler: server.ErrorHandler})
+	app.Use(srv.Authenticate)
+	app.Get("/files", func(ctx *fiber.Ctx) error { return ctx.SendStatus(http.StatusOK) })
+	app.Get("/keys", srv.RequireAdmin, func(ctx *fiber.Ctx) error { return ctx.SendStatus(http.StatusOK) })
+
+	now := time.Now()
+	valid := jwt.Claims{Subject: "alice", Issuer: testIssuer, Expiry: jwt.NewNumericDate(now.Add(time.Hour))}
+	expired := jwt.Claims{Subject: "alice", Issuer: testIssuer, Expiry: jwt.NewNumericDate(now.Add(-time.Hour))}
+	otherIssuer := jwt.Claims{Subject: "alice", Issuer: "https://other.example", Expiry: valid.Expiry}
+	noExpiry := jwt.Claims{Subject: "alice", Issuer: testIssuer}
+
+	basic := base64.StdEncoding.EncodeToString([]byte("anyone:" + testAdminKey))
+
+	tests := []struct {
+		name          string
+		authorization string
+		files         int
+		keys          int
+	}{
+		{name: "no credentials", files: http.StatusUnauthorized, keys: http.StatusUnauthorized},
+		{name: "admin key", authorization: "Bearer " + testAdminKey, files: http.StatusOK, keys: http.StatusOK},
+		{name: "admin key over basic", authorization: "Basic " + basic, files: http.StatusOK, keys: http.StatusOK},
+		{name: "wrong key", authorization: "Bearer nope", files: http.StatusUnauthorized, keys: http.StatusUnauthorized},
+		{
+			name: "token", authorization: "Bearer " + signToken(t, signer, valid, ""),
+			files: http.StatusOK, keys: http.StatusForbidden,
+		},
+		{
+			name: "admin token", authorization: "Bearer " + signToken(t, signer, valid, "files dss:admin"),
+			files: http.StatusOK, keys: http.StatusOK,
+		},
+		{
+			name: "expired token", authorization: "Bearer " + signToken(t, signer, expired, ""),
+			files: http.StatusUnauthorized, keys: http.StatusUnauthorized,
+		},
+		{
+			name: "other issuer", authorization: "Bearer " + signToken(t, signer, otherIssuer, ""),
+			files: http.StatusUnauthorized, keys: http.StatusUnauthorized,
+		},
+		{
+			name: "token without expiry", authorization: "Bearer " + signToken(t, signer, noExpiry, ""),
+			files: http.StatusUnauthorized, keys: http.StatusUnauthorized,
+		},
+		{
+			name: "unknown signer", authorization: "Bearer " + signToken(t, stranger, valid, "dss:admin"),
+			files: http.StatusUnauthorized, keys: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		for target, expected := range map[string]int{"/files": test.files, "/keys": test.keys} {
+			request := httptest.NewRequest(http.MethodGet, target, nil)
+			if test.authorization != "" {
+				request.Header.Set(fiber.HeaderAuthorization, test.authorization)
+			}
+
+			response, err := app.Test(request)
+			require.NoError(t, err)
+			require.Equalf(t, expected, response.StatusCode, "%s %s", test.name, target)
+
+			if expected == http.StatusUnauthorized {
+				require.NotEmpty(t, response.Header.Get(fiber.HeaderWWWAuthenticate))
+			}
+		}
+	}
+}
+
+func Test_requireAdminWithoutAuth(t *testing.T) {
+	srv, err := server.NewServer(&config.Config{}, nil, nil)
+	require.NoError(t, err)
+
+	app := fiber.New(fiber.Config{ErrorHandler: server.ErrorHandler})
+	app.Use(srv.Authenticate)
+	app.Get("/keys", srv.RequireAdmin, func(ctx *fiber.Ctx) error { return ctx.SendStatus(http.StatusOK) })
+
+	response, err := app.Test(httptest.NewRequest(http.MethodGet, "/keys", nil))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, response.StatusCode)
+}
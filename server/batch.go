@@ -0,0 +1,221 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	OpDelete = "delete"
+	OpMove   = "move"
+	OpRename = "rename"
+	OpMkdir  = "mkdir"
+	OpTag    = "tag"
+)
+
+var errBatchFailed = errors.New("an operation of the batch failed")
+
+type BatchOperation struct {
+	Op        string   `json:"op"`
+	ID        string   `json:"id,omitempty"`
+	NewPath   string   `json:"newpath,omitempty"`
+	NewName   string   `json:"new_name,omitempty"`
+	Path      string   `json:"path,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Conflict  string   `json:"conflict,omitempty"`
+	Parents   bool     `json:"parents,omitempty"`
+	Recursive bool     `json:"recursive,omitempty"`
+}
+
+type BatchRequest struct {
+	// Atomic runs every operation in a single transaction, so either all of
+	// them are applied or none is.
+	Atomic     bool             `json:"atomic"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+type BatchResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	ID     string `json:"id,omitempty"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Applied bool          `json:"applied"`
+	Results []BatchResult `json:"results"`
+}
+
+func (s *Server) Batch(ctx *fiber.Ctx) error {
+	var request BatchRequest
+	if err := ctx.BodyParser(&request); err != nil {
+		return fiber.NewError(http.StatusBadRequest, "the batch must be a json object with a list of operations")
+	}
+
+	if len(request.Operations) == 0 {
+		return fiber.NewError(http.StatusBadRequest, "operations cant be empty")
+	}
+
+	if len(request.Operations) > s.batchLimit {
+		return quotaError(fmt.Sprintf("a batch is limited to %d operations", s.batchLimit))
+	}
+
+	if !request.Atomic {
+		response := BatchResponse{Applied: true, Results: s.runBatch(ctx.Context(), request.Operations, false)}
+		return ctx.JSON(response)
+	}
+
+	var results []BatchResult
+
+	err := s.catalog.WithTransaction(ctx.Context(), func(txContext context.Context) error {
+		results = s.runBatch(txContext, request.Operations, true)
+
+		for _, result := range results {
+			if result.Error != "" {
+				return errBatchFailed
+			}
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, errBatchFailed) {
+		return ctx.Status(http.StatusConflict).JSON(BatchResponse{Applied: false, Results: results})
+	} else if err != nil {
+		log.Error(err)
+		return fiber.NewError(http.StatusInternalServerError, "the batch transaction failed")
+	}
+
+	return ctx.JSON(BatchResponse{Applied: true, Results: results})
+}
+
+// runBatch applies the operations in order, with stopOnError the remaining
+// operations are skipped after the first failure.
+func (s *Server) runBatch(ctx context.Context, operations []BatchOperation, stopOnError bool) []BatchResult {
+	results := make([]BatchResult, 0, len(operations))
+	failed := false
+
+	for i, operation := range operations {
+		result := BatchResult{Index: i, Op: operation.Op, ID: operation.ID, Status: http.StatusOK}
+
+		if failed && stopOnError {
+			result.Status = http.StatusFailedDependency
+			result.Error = "skipped because an earlier operation failed"
+			results = append(results, result)
+
+			continue
+		}
+
+		id, err := s.runOperation(ctx, operation)
+		if id != "" {
+			result.ID = id
+		}
+
+		if err != nil {
+			failed = true
+			apiErr := asError(err)
+			if apiErr.Status >= http.StatusInternalServerError {
+				log.Error(err)
+			}
+
+			result.Status = apiErr.Status
+			result.Error = apiErr.Message
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func (s *Server) runOperation(ctx context.Context, operation BatchOperation) (string, error) {
+	fallback := ConflictRename
+	if operation.Op == OpMkdir {
+		fallback = mkdirFallback(operation.Parents)
+	}
+
+	policy, err := parseConflictPolicy(operation.Conflict, fallback)
+	if err != nil {
+		return "", err
+	}
+
+	if operation.Op == OpMkdir {
+		return s.batchMkdir(ctx, operation, policy)
+	}
+
+	metadata, exists := s.datastore.GetMetadataByID(ctx, operation.ID)
+	if !exists {
+		return "", notFoundError("file not found")
+	}
+
+	switch operation.Op {
+	case OpDelete:
+		return "", s.remove(ctx, metadata, operation.Recursive)
+	case OpMove:
+		newPath := cleanPath(operation.NewPath)
+		if !validatePath(newPath) {
+			return "", errInvalidPath
+		}
+
+		newName := metadata.FileName
+		if operation.NewName != "" {
+			newName = sanitizeFilename(operation.NewName)
+		}
+
+		return "", s.move(ctx, metadata, newPath, newName, policy)
+	case OpRename:
+		if operation.NewName == "" {
+			return "", fiber.NewError(http.StatusBadRequest, "new_name cant be empty")
+		}
+
+		return "", s.move(ctx, metadata, metadata.Path, sanitizeFilename(operation.NewName), policy)
+	case OpTag:
+		tags, err := normalizeTags(operation.Tags)
+		if err != nil {
+			return "", err
+		}
+
+		if len(tags) == 0 {
+			return "", fiber.NewError(http.StatusBadRequest, "tags cant be empty")
+		}
+
+		return "", s.catalog.AddTags(ctx, metadata.Id.Hex(), tags)
+	}
+
+	return "", fiber.NewError(http.StatusBadRequest, fmt.Sprintf("unknown operation %q", operation.Op))
+}
+
+func (s *Server) batchMkdir(ctx context.Context, operation BatchOperation, policy ConflictPolicy) (string, error) {
+	if operation.Name == "" {
+		return "", fiber.NewError(http.StatusBadRequest, "name cant be empty")
+	}
+
+	targetPath := cleanPath(operation.Path)
+	if targetPath == "" {
+		targetPath = "/"
+	}
+
+	if !validatePath(targetPath) {
+		return "", errInvalidPath
+	}
+
+	if operation.Parents {
+		if err := s.ensureDir(ctx, targetPath); err != nil {
+			return "", err
+		}
+	}
+
+	metadata, _, err := s.makeDir(ctx, targetPath, sanitizeFilename(operation.Name), policy)
+	if err != nil {
+		return "", err
+	}
+
+	return metadata.Id.Hex(), nil
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gofiber/fiber/v2"
+)
+
+const bodyKey = "body"
+
+// limitedReader fails with 413 once more than limit bytes were read from it.
+type limitedReader struct {
+	reader io.Reader
+	limit  int64
+	read   int64
+}
+
+func newLimitedReader(reader io.Reader, limit int64) *limitedReader {
+	return &limitedReader{reader: reader, limit: limit}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.reader.Read(p)
+
+	l.read += int64(n)
+	if l.read > l.limit {
+		return n, tooLarge(l.limit)
+	}
+
+	return n, err
+}
+
+func tooLarge(limit int64) error {
+	return quotaError(fmt.Sprintf("the body is larger than %s", humanize.IBytes(uint64(limit))))
+}
+
+// LimitBody enforces the size of request bodies. The app streams bodies so
+// uploads don't have to fit in memory, which makes fasthttp hand over bodies
+// of any size. The routes streamed accepts read their body as a stream of at
+// most limit bytes, every other body is read here up to formLimit bytes.
+func LimitBody(limit int64, formLimit int64, streamed func(ctx *fiber.Ctx) bool) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// chunked and close delimited bodies report a negative length.
+		length := int64(ctx.Request().Header.ContentLength())
+		stream := ctx.Context().RequestBodyStream()
+
+		if streamed(ctx) {
+			if length > limit {
+				return rejectBody(ctx, limit)
+			}
+
+			if stream != nil {
+				ctx.Locals(bodyKey, newLimitedReader(stream, limit))
+			}
+
+			return ctx.Next()
+		}
+
+		if length > formLimit {
+			return rejectBody(ctx, formLimit)
+		}
+
+		if stream == nil {
+			return ctx.Next()
+		}
+
+		body, err := io.ReadAll(newLimitedReader(stream, formLimit))
+		if err != nil {
+			if apiErr := asError(err); apiErr.Status == http.StatusRequestEntityTooLarge {
+				return rejectBody(ctx, formLimit)
+			}
+
+			ctx.Context().SetConnectionClose()
+
+			return fiber.NewError(http.StatusBadRequest, "could not read the body")
+		}
+
+		ctx.Request().SetBody(body)
+
+		return ctx.Next()
+	}
+}
+
+// rejectBody answers a body that is too large without reading the rest of
+// it, the connection is closed since the next request would start inside it.
+func rejectBody(ctx *fiber.Ctx, limit int64) error {
+	ctx.Context().SetConnectionClose()
+	return tooLarge(limit)
+}
+
+// requestBody returns the body of a streamed route, bounded by LimitBody.
+func requestBody(ctx *fiber.Ctx) io.Reader {
+	if body, ok := ctx.Locals(bodyKey).(io.Reader); ok {
+		return body
+	}
+
+	if stream := ctx.Context().RequestBodyStream(); stream != nil {
+		return stream
+	}
+
+	return bytes.NewReader(ctx.Body())
+}
@@ -0,0 +1,54 @@
+package server_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"dss-main/server"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_limitBody(t *testing.T) {
+	app := fiber.New(fiber.Config{StreamRequestBody: true, ErrorHandler: server.ErrorHandler})
+	app.Use(server.LimitBody(64, 8, func(ctx *fiber.Ctx) bool { return ctx.Path() == "/upload" }))
+	app.Post("/*", func(ctx *fiber.Ctx) error { return ctx.Send(ctx.Body()) })
+
+	tests := []struct {
+		name    string
+		target  string
+		body    string
+		chunked bool
+		status  int
+	}{
+		{name: "small form", target: "/form", body: "a=1", status: http.StatusOK},
+		{name: "large form", target: "/form", body: strings.Repeat("a", 9), status: http.StatusRequestEntityTooLarge},
+		{name: "large chunked form", target: "/form", body: strings.Repeat("a", 9), chunked: true,
+			status: http.StatusRequestEntityTooLarge},
+		{name: "upload", target: "/upload", body: strings.Repeat("a", 64), status: http.StatusOK},
+		{name: "large upload", target: "/upload", body: strings.Repeat("a", 65),
+			status: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodPost, test.target, strings.NewReader(test.body))
+		if test.chunked {
+			request.ContentLength = -1
+			request.TransferEncoding = []string{"chunked"}
+		}
+
+		response, err := app.Test(request)
+		require.NoError(t, err)
+		require.Equal(t, test.status, response.StatusCode, test.name)
+
+		if test.status == http.StatusOK {
+			content, readErr := io.ReadAll(response.Body)
+			require.NoError(t, readErr)
+			require.Equal(t, test.body, string(content), test.name)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/yakiroren/dss-common/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ConflictPolicy decides what happens when a file is written where another
+// one already exists.
+type ConflictPolicy string
+
+const (
+	// ConflictRename picks a free name(n).ext name instead.
+	ConflictRename ConflictPolicy = "rename"
+	// ConflictOverwrite replaces the existing file, directories are never replaced.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictFail rejects the request with 409.
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictSkip leaves the existing file untouched and reports success.
+	ConflictSkip ConflictPolicy = "skip"
+)
+
+var errSkipped = errors.New("skipped because the name is taken")
+
+// conflictPolicy reads the conflict policy of a request from the form or the
+// query string.
+func conflictPolicy(ctx *fiber.Ctx, fallback ConflictPolicy) (ConflictPolicy, error) {
+	return parseConflictPolicy(ctx.FormValue("conflict", ctx.Query("conflict")), fallback)
+}
+
+// parseConflictPolicy validates a conflict policy, an empty value is the
+// fallback.
+func parseConflictPolicy(value string, fallback ConflictPolicy) (ConflictPolicy, error) {
+	policy := ConflictPolicy(value)
+	if policy == "" {
+		policy = fallback
+	}
+
+	switch policy {
+	case ConflictRename, ConflictOverwrite, ConflictFail, ConflictSkip:
+		return policy, nil
+	}
+
+	return "", fiber.NewError(http.StatusBadRequest, "conflict must be one of rename, overwrite, fail or skip")
+}
+
+// resolveConflict returns the name under which self can be written into dir.
+// errSkipped is returned when the policy is skip and the name is taken. With
+// the overwrite policy a taken name is returned with overwrite set, the
+// existing file is left in place until replace swaps self in.
+func (s *Server) resolveConflict(ctx context.Context, dir string, name string, policy ConflictPolicy,
+	self primitive.ObjectID,
+) (string, bool, error) {
+	existing, exists := s.datastore.GetMetadataByPath(ctx, filepath.Join(dir, name))
+	if !exists || existing.Id == self {
+		return name, false, nil
+	}
+
+	switch policy {
+	case ConflictRename:
+		name, err := s.fixFilename(ctx, name, dir)
+		return name, false, err
+	case ConflictSkip:
+		return name, false, errSkipped
+	case ConflictOverwrite:
+		if existing.IsDirectory {
+			return "", false, conflictError("a directory can't be overwritten")
+		}
+
+		return name, true, nil
+	case ConflictFail:
+	}
+
+	return "", false, conflictError(fmt.Sprintf("%s already exists", filepath.Join(dir, name)))
+}
+
+// stagedName is the name a file overwriting name is written under until it
+// is complete, so a failed write never costs the file it was meant to replace.
+func stagedName(name string, id primitive.ObjectID) string {
+	return "." + name + "." + id.Hex() + ".partial"
+}
+
+// replacedName is the name a file that is being overwritten is moved to
+// until the file replacing it holds its name.
+func replacedName(name string, id primitive.ObjectID) string {
+	return "." + name + "." + id.Hex() + ".replaced"
+}
+
+// replace gives a staged file the name it overwrites. The file holding the
+// name is moved aside first and only deleted once the staged file took its
+// name, so a failure at any step keeps one of them under the name. Nothing
+// happens when name is empty.
+func (s *Server) replace(ctx context.Context, staged *models.FileMetadata, name string) error {
+	if name == "" {
+		return nil
+	}
+
+	existing, exists := s.datastore.GetMetadataByPath(ctx, filepath.Join(staged.Path, name))
+	if exists && existing.Id == staged.Id {
+		exists = false
+	}
+
+	if exists {
+		if existing.IsDirectory {
+			return conflictError("a directory can't be overwritten")
+		}
+
+		if err := s.relocate(ctx, existing, existing.Path, replacedName(name, existing.Id)); err != nil {
+			return err
+		}
+	}
+
+	if err := s.relocate(ctx, staged, staged.Path, name); err != nil {
+		if exists {
+			if restoreErr := s.relocate(context.Background(), existing, existing.Path, name); restoreErr != nil {
+				log.Error("could not restore ", filepath.Join(existing.Path, name), ": ", restoreErr)
+			}
+		}
+
+		return err
+	}
+
+	staged.FileName = name
+
+	if exists {
+		// the new file is in place, a failure here only leaves the old one
+		// behind under its aside name.
+		existing.FileName = replacedName(name, existing.Id)
+		if err := s.remove(context.Background(), existing, false); err != nil {
+			log.Error("could not delete the replaced file ", existing.Id.Hex(), ": ", err)
+		}
+	}
+
+	return nil
+}
+
+// discard deletes a file whose content could not be stored. It runs after
+// the request may have been cancelled, so it doesn't use its context.
+func (s *Server) discard(metadata *models.FileMetadata) {
+	if err := s.remove(context.Background(), metadata, true); err != nil {
+		log.Error("could not delete the incomplete file ", metadata.Id.Hex(), ": ", err)
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yakiroren/dss-common/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *Server) Copy(ctx *fiber.Ctx) error {
+	id := ctx.Params("id")
+
+	metadata, exists := s.datastore.GetMetadataByID(ctx.Context(), id)
+	if !exists {
+		return notFoundError("file not found")
+	}
+
+	newpath := cleanPath(ctx.FormValue("newpath", metadata.Path))
+
+	valid := validatePath(newpath)
+	if !valid {
+		return errInvalidPath
+	}
+
+	policy, err := conflictPolicy(ctx, ConflictRename)
+	if err != nil {
+		return err
+	}
+
+	newName := sanitizeFilename(ctx.FormValue("new_name", metadata.FileName))
+
+	copied, err := s.copy(ctx.Context(), metadata, newpath, newName, policy)
+	if errors.Is(err, errSkipped) {
+		return ctx.Status(http.StatusOK).JSON(newDisplayMetadata(*copied))
+	} else if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusCreated).JSON(newDisplayMetadata(*copied))
+}
+
+// copy duplicates the metadata of a file, or of a directory and everything
+// under it, into newPath. Fragments are immutable so copies share them.
+func (s *Server) copy(ctx context.Context, metadata *models.FileMetadata, newPath string, newName string,
+	policy ConflictPolicy,
+) (*models.FileMetadata, error) {
+	if isProcessing(metadata) {
+		return nil, conflictError("the file is still being uploaded")
+	}
+
+	source := filepath.Join(metadata.Path, metadata.FileName)
+	if metadata.IsDirectory && (newPath == source || strings.HasPrefix(newPath, strings.TrimSuffix(source, "/")+"/")) {
+		return nil, fiber.NewError(http.StatusBadRequest, "a directory can't be copied into itself")
+	}
+
+	var children []models.FileMetadata
+
+	if metadata.IsDirectory {
+		subtree, err := s.catalog.Subtree(ctx, source, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		children = subtree
+	}
+
+	root := duplicate(*metadata)
+	root.Path = newPath
+	root.FileName = newName
+
+	_, replaces, err := s.create(ctx, &root, policy)
+	if errors.Is(err, errSkipped) {
+		existing, _ := s.datastore.GetMetadataByPath(ctx, filepath.Join(newPath, newName))
+		return existing, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	destination := filepath.Join(newPath, root.FileName)
+
+	// the subtree is sorted by path, so every directory is inserted before
+	// its children.
+	for _, child := range children {
+		copied := duplicate(child)
+		copied.Path = destination + strings.TrimPrefix(child.Path, source)
+
+		if _, err = s.insert(ctx, copied); err != nil {
+			s.discard(&root)
+			return nil, err
+		}
+	}
+
+	if err = s.replace(ctx, &root, replaces); err != nil {
+		s.discard(&root)
+		return nil, err
+	}
+
+	return &root, nil
+}
+
+func duplicate(metadata models.FileMetadata) models.FileMetadata {
+	metadata.Id = primitive.NewObjectID()
+	metadata.CreationTime = time.Now().Unix()
+	metadata.Fragments = append([]models.Fragment{}, metadata.Fragments...)
+	metadata.Tags = append([]string{}, metadata.Tags...)
+
+	return metadata
+}
@@ -0,0 +1,567 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ds "dss-main/storage"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/yakiroren/dss-common/models"
+	"golang.org/x/net/webdav"
+)
+
+// WebDAV serves the namespace over WebDAV under prefix, so DSS can be
+// mounted as a network drive. Writes go through the same integrity layer
+// and fragment pipeline as the REST api.
+func (s *Server) WebDAV(prefix string) http.Handler {
+	handler := &webdav.Handler{
+		Prefix:     prefix,
+		FileSystem: davFS{server: s},
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				log.Warn("webdav ", r.Method, " ", r.URL.Path, ": ", err)
+			}
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.davAuthenticate(w, r) {
+			return
+		}
+
+		// copies share fragments instead of downloading and uploading them
+		// again, a depth 0 copy of a directory is left to the generic handler.
+		if r.Method == "COPY" && r.Header.Get("Depth") != "0" {
+			s.davCopy(w, r, prefix)
+			return
+		}
+
+		if r.Method == http.MethodPut {
+			put := &davPut{body: r.Body, length: r.ContentLength}
+			r.Body = put
+			r = r.WithContext(context.WithValue(r.Context(), davPutKey{}, put))
+			w = &davPutWriter{ResponseWriter: w, put: put}
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+type davPutKey struct{}
+
+var errIncompleteBody = errors.New("the body ended before it was complete")
+
+// davPut follows the body of a PUT, the webdav handler closes the file it
+// writes to even when reading the body failed and answers every failure to
+// create it with 404.
+type davPut struct {
+	body    io.ReadCloser
+	length  int64
+	read    int64
+	readErr error
+	// err is why storing the file failed.
+	err error
+}
+
+func (p *davPut) Read(b []byte) (int, error) {
+	n, err := p.body.Read(b)
+	p.read += int64(n)
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		p.readErr = err
+	}
+
+	return n, err
+}
+
+func (p *davPut) Close() error {
+	return p.body.Close()
+}
+
+// complete reports whether the whole body was read.
+func (p *davPut) complete() bool {
+	return p.readErr == nil && (p.length < 0 || p.read == p.length)
+}
+
+// davPutWriter answers a failed PUT with the status of the error that
+// stopped it.
+type davPutWriter struct {
+	http.ResponseWriter
+	put        *davPut
+	overridden bool
+}
+
+func (w *davPutWriter) WriteHeader(status int) {
+	if w.put.err != nil && status >= http.StatusBadRequest {
+		status = davPutStatus(w.put.err)
+		w.overridden = true
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *davPutWriter) Write(b []byte) (int, error) {
+	// the handler writes the text of the status it chose.
+	if w.overridden {
+		return len(b), nil
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// davPutStatus is 409 for a missing parent collection, as for MKCOL.
+func davPutStatus(err error) int {
+	if errors.Is(err, errIncompleteBody) {
+		return http.StatusBadRequest
+	}
+
+	status := davStatus(err)
+	if status == http.StatusNotFound {
+		return http.StatusConflict
+	}
+
+	return status
+}
+
+// davAuthenticate answers requests without valid credentials, WebDAV
+// clients send the api key or the token as the password of Basic auth.
+func (s *Server) davAuthenticate(w http.ResponseWriter, r *http.Request) bool {
+	if s.auth == nil {
+		return true
+	}
+
+	_, err := s.auth.authenticate(r.Context(), r.Header.Get("Authorization"))
+	if err == nil {
+		return true
+	}
+
+	apiErr := asError(err)
+	if apiErr.Status >= http.StatusInternalServerError {
+		log.Error(err)
+	}
+
+	w.Header().Set("WWW-Authenticate", `Basic realm="dss"`)
+	http.Error(w, apiErr.Message, apiErr.Status)
+
+	return false
+}
+
+func (s *Server) davCopy(w http.ResponseWriter, r *http.Request, prefix string) {
+	source, ok := davRequestPath(r.URL.Path, prefix)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	destinationURL, err := url.Parse(r.Header.Get("Destination"))
+	if err != nil || (destinationURL.Host != "" && destinationURL.Host != r.Host) {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	destination, ok := davRequestPath(destinationURL.Path, prefix)
+	if !ok {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	if source == destination {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+
+	metadata, exists := s.datastore.GetMetadataByPath(ctx, source)
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	dir, name := filepath.Dir(destination), filepath.Base(destination)
+	if !validatePath(dir) || !validName(name) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	status := http.StatusCreated
+
+	if existing, found := s.datastore.GetMetadataByPath(ctx, destination); found {
+		if r.Header.Get("Overwrite") == "F" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+
+		// a file is replaced once the copy is complete, a directory is not
+		// merged with the copy so it goes first.
+		if existing.IsDirectory {
+			if err = s.remove(ctx, existing, true); err != nil {
+				w.WriteHeader(davStatus(err))
+				return
+			}
+		}
+
+		status = http.StatusNoContent
+	}
+
+	if _, err = s.copy(ctx, metadata, dir, name, ConflictOverwrite); err != nil {
+		// a missing parent of the destination is a conflict for COPY.
+		status = davStatus(err)
+		if status == http.StatusNotFound {
+			status = http.StatusConflict
+		}
+	}
+
+	w.WriteHeader(status)
+}
+
+// davRequestPath strips prefix from the path of a request and normalizes
+// it the way names are stored.
+func davRequestPath(requestPath string, prefix string) (string, bool) {
+	if !strings.HasPrefix(requestPath, prefix) {
+		return "", false
+	}
+
+	return davPath(strings.TrimPrefix(requestPath, prefix)), true
+}
+
+func davPath(name string) string {
+	return cleanPath(path.Clean("/" + name))
+}
+
+func davStatus(err error) int {
+	return asError(err).Status
+}
+
+// davError translates the errors of the integrity layer into the os errors
+// the webdav handler maps to status codes.
+func davError(op string, name string, err error) error {
+	switch davStatus(err) {
+	case http.StatusNotFound:
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	case http.StatusConflict:
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrExist}
+	case http.StatusBadRequest:
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	return err
+}
+
+// davFS implements webdav.FileSystem on top of the namespace.
+type davFS struct {
+	server *Server
+}
+
+func (d davFS) Mkdir(ctx context.Context, name string, _ os.FileMode) error {
+	p := davPath(name)
+
+	dir, base := filepath.Dir(p), filepath.Base(p)
+	if p == "/" || !validatePath(dir) || !validName(base) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if _, _, err := d.server.makeDir(ctx, dir, base, ConflictFail); err != nil {
+		return davError("mkdir", name, err)
+	}
+
+	return nil
+}
+
+func (d davFS) OpenFile(ctx context.Context, name string, flag int, _ os.FileMode) (webdav.File, error) {
+	p := davPath(name)
+
+	// PROPPATCH opens files read write without changing their content, only
+	// a create or a truncate replaces it.
+	if flag&(os.O_CREATE|os.O_TRUNC) != 0 {
+		return d.create(ctx, name, p)
+	}
+
+	metadata, exists := d.server.datastore.GetMetadataByPath(ctx, p)
+	if !exists {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return &davFile{ctx: ctx, server: d.server, metadata: metadata}, nil
+}
+
+// create registers a file of unknown size that replaces whatever is at p
+// once all of its content was published, it is published while written.
+func (d davFS) create(ctx context.Context, name string, p string) (webdav.File, error) {
+	put, _ := ctx.Value(davPutKey{}).(*davPut)
+
+	dir, base := filepath.Dir(p), filepath.Base(p)
+	if p == "/" || !validatePath(dir) || !validName(base) {
+		if put != nil {
+			put.err = errInvalidPath
+		}
+
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	registered, err := d.server.register(ctx, upload{
+		path:      dir,
+		name:      base,
+		size:      unknownSize,
+		policy:    ConflictOverwrite,
+		versioned: d.server.catalog.Versioning(ctx, dir),
+	})
+	if err != nil {
+		if put != nil {
+			put.err = err
+		}
+
+		return nil, davError("open", name, err)
+	}
+
+	reader, writer := io.Pipe()
+	file := &davWriter{name: registered.Name, pipe: writer, put: put, done: make(chan error, 1)}
+
+	go func() {
+		publishErr := d.server.publish(ctx, registered.ID, unknownSize, reader)
+		publishErr = d.server.complete(ctx, registered, publishErr)
+		if publishErr != nil {
+			log.Error("webdav upload of ", p, " failed: ", publishErr)
+		}
+
+		// unblocks the writer when publishing stopped early.
+		reader.CloseWithError(publishErr)
+		file.done <- publishErr
+	}()
+
+	return file, nil
+}
+
+func (d davFS) RemoveAll(ctx context.Context, name string) error {
+	p := davPath(name)
+	if p == "/" {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+	}
+
+	metadata, exists := d.server.datastore.GetMetadataByPath(ctx, p)
+	if !exists {
+		return nil
+	}
+
+	if err := d.server.remove(ctx, metadata, true); err != nil {
+		return davError("remove", name, err)
+	}
+
+	return nil
+}
+
+func (d davFS) Rename(ctx context.Context, oldName string, newName string) error {
+	metadata, exists := d.server.datastore.GetMetadataByPath(ctx, davPath(oldName))
+	if !exists {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrNotExist}
+	}
+
+	p := davPath(newName)
+
+	dir, base := filepath.Dir(p), filepath.Base(p)
+	if p == "/" || !validatePath(dir) || !validName(base) {
+		return &fs.PathError{Op: "rename", Path: newName, Err: fs.ErrInvalid}
+	}
+
+	if err := d.server.move(ctx, metadata, dir, base, ConflictFail); err != nil {
+		return davError("rename", newName, err)
+	}
+
+	return nil
+}
+
+func (d davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	metadata, exists := d.server.datastore.GetMetadataByPath(ctx, davPath(name))
+	if !exists {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return davInfo{*metadata}, nil
+}
+
+// davInfo answers the content type from the extension, otherwise listing a
+// directory would download the start of every file in it to sniff it.
+type davInfo struct {
+	models.FileMetadata
+}
+
+func (i davInfo) ContentType(_ context.Context) (string, error) {
+	if contentType := mime.TypeByExtension(filepath.Ext(i.FileName)); contentType != "" {
+		return contentType, nil
+	}
+
+	return "application/octet-stream", nil
+}
+
+// davFile reads a stored file, seeking only fetches the fragments from the
+// new offset onwards.
+type davFile struct {
+	ctx      context.Context
+	server   *Server
+	metadata *models.FileMetadata
+	offset   int64
+	reader   io.ReadCloser
+}
+
+func (f *davFile) Read(p []byte) (int, error) {
+	if f.metadata.IsDirectory {
+		return 0, &fs.PathError{Op: "read", Path: f.metadata.FileName, Err: fs.ErrInvalid}
+	}
+
+	if f.offset >= f.metadata.FileSize {
+		return 0, io.EOF
+	}
+
+	if f.reader == nil {
+		reader, err := ds.ReadFragmentsAt(f.ctx, f.server.storage, f.metadata.Fragments, f.offset)
+		if err != nil {
+			return 0, err
+		}
+
+		f.reader = reader
+	}
+
+	n, err := f.reader.Read(p)
+	f.offset += int64(n)
+
+	return n, err
+}
+
+func (f *davFile) Seek(offset int64, whence int) (int64, error) {
+	position := offset
+
+	switch whence {
+	case io.SeekCurrent:
+		position += f.offset
+	case io.SeekEnd:
+		position += f.metadata.FileSize
+	}
+
+	if position < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.metadata.FileName, Err: fs.ErrInvalid}
+	}
+
+	if position != f.offset {
+		if err := f.Close(); err != nil {
+			return 0, err
+		}
+
+		f.offset = position
+	}
+
+	return position, nil
+}
+
+func (f *davFile) Readdir(_ int) ([]fs.FileInfo, error) {
+	if !f.metadata.IsDirectory {
+		return nil, &fs.PathError{Op: "readdir", Path: f.metadata.FileName, Err: fs.ErrInvalid}
+	}
+
+	files, err := f.server.datastore.ListFiles(f.ctx, filepath.Join(f.metadata.Path, f.metadata.FileName))
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]fs.FileInfo, 0, len(files))
+
+	for _, file := range files {
+		if isRoot(file) {
+			continue
+		}
+
+		infos = append(infos, davInfo{file})
+	}
+
+	return infos, nil
+}
+
+func (f *davFile) Stat() (fs.FileInfo, error) {
+	return davInfo{*f.metadata}, nil
+}
+
+func (f *davFile) Write(_ []byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.metadata.FileName, Err: fs.ErrPermission}
+}
+
+func (f *davFile) Close() error {
+	if f.reader == nil {
+		return nil
+	}
+
+	err := f.reader.Close()
+	f.reader = nil
+
+	return err
+}
+
+// davWriter feeds a PUT body to the fragment publisher, Close waits until
+// the metadata of the file is complete. A body that ended early fails the
+// upload, so the file it was meant to replace is kept.
+type davWriter struct {
+	name    string
+	written int64
+	pipe    *io.PipeWriter
+	put     *davPut
+	failed  bool
+	done    chan error
+}
+
+func (w *davWriter) Write(p []byte) (int, error) {
+	n, err := w.pipe.Write(p)
+	w.written += int64(n)
+
+	// writes only fail once publishing stopped.
+	if err != nil {
+		w.failed = true
+	}
+
+	return n, err
+}
+
+func (w *davWriter) Close() error {
+	if !w.failed && w.put != nil && !w.put.complete() {
+		_ = w.pipe.CloseWithError(errIncompleteBody)
+		<-w.done
+
+		w.put.err = errIncompleteBody
+
+		return errIncompleteBody
+	}
+
+	_ = w.pipe.Close()
+
+	err := <-w.done
+	if w.put != nil && err != nil {
+		w.put.err = err
+	}
+
+	return err
+}
+
+func (w *davWriter) Stat() (fs.FileInfo, error) {
+	return davInfo{models.FileMetadata{FileName: w.name, FileSize: w.written, CreationTime: time.Now().Unix()}}, nil
+}
+
+func (w *davWriter) Read(_ []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: w.name, Err: fs.ErrPermission}
+}
+
+func (w *davWriter) Seek(_ int64, _ int) (int64, error) {
+	return 0, &fs.PathError{Op: "seek", Path: w.name, Err: fs.ErrPermission}
+}
+
+func (w *davWriter) Readdir(_ int) ([]fs.FileInfo, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: w.name, Err: fs.ErrInvalid}
+}
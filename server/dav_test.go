@@ -0,0 +1,43 @@
+package server_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yakiroren/dss-common/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Test_davProppatchKeepsContent(t *testing.T) {
+	file := &models.FileMetadata{
+		Id:             primitive.NewObjectID(),
+		Path:           "/",
+		FileName:       "file.txt",
+		FileSize:       10,
+		TotalFragments: 3,
+		Fragments:      []models.Fragment{{Name: "1", Size: 4}, {Name: "2", Size: 4}, {Name: "3", Size: 2}},
+	}
+
+	handler := newTestServer(t, file).WebDAV("/dav")
+
+	body := `<?xml version="1.0"?>
+<D:propertyupdate xmlns:D="DAV:" xmlns:Z="urn:example">
+  <D:set><D:prop><Z:color>red</Z:color></D:prop></D:set>
+</D:propertyupdate>`
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("PROPPATCH", "/dav/file.txt", strings.NewReader(body)))
+	require.Equal(t, http.StatusMultiStatus, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/dav/file.txt", http.NoBody))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	content, err := io.ReadAll(recorder.Body)
+	require.NoError(t, err)
+	require.Equal(t, "abcdefghij", string(content))
+}
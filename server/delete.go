@@ -9,9 +9,15 @@ import (
 func (s *Server) Delete(ctx *fiber.Ctx) error {
 	id := ctx.Params("id")
 
-	success := s.datastore.Delete(ctx.Context(), id)
-	if !success {
-		return fiber.NewError(http.StatusBadRequest, "could not delete")
+	metadata, exists := s.datastore.GetMetadataByID(ctx.Context(), id)
+	if !exists {
+		return notFoundError("file not found")
+	}
+
+	recursive := ctx.QueryBool("recursive")
+
+	if err := s.remove(ctx.Context(), metadata, recursive); err != nil {
+		return err
 	}
 
 	ctx.Status(http.StatusOK)
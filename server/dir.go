@@ -3,8 +3,13 @@ package server
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"path/filepath"
+	"strconv"
+	"time"
+
+	"dss-main/catalog"
 
 	"github.com/dustin/go-humanize"
 	"github.com/gofiber/fiber/v2"
@@ -17,88 +22,267 @@ type DisplayMetadata struct {
 	ID           interface{} `json:"id"`
 	FileName     string      `json:"name"`
 	Size         string      `json:"size"`
+	Bytes        int64       `json:"bytes"`
+	Created      string      `json:"created"`
+	CreationTime int64       `json:"creation_time"`
 	IsDirectory  bool        `json:"directory"`
 	IsProcessing bool        `json:"processing"`
 	Path         string      `json:"path"`
 }
 
-func (s *Server) Dir(ctx *fiber.Ctx) error {
+// NextCursorHeader carries the cursor of the next page of a directory
+// listing, it is missing on the last page.
+const NextCursorHeader = "X-Next-Cursor"
+
+type DirListing struct {
+	Items      []DisplayMetadata `json:"items"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+func newDisplayMetadata(file models.FileMetadata) DisplayMetadata {
+	return DisplayMetadata{
+		ID:           file.Id,
+		FileName:     file.FileName,
+		Size:         humanize.IBytes(uint64(file.FileSize)),
+		Bytes:        file.FileSize,
+		Created:      humanize.Time(time.Unix(file.CreationTime, 0)),
+		CreationTime: file.CreationTime,
+		IsDirectory:  file.IsDirectory,
+		IsProcessing: file.IsHidden,
+		Path:         filepath.Join(file.Path, file.FileName),
+	}
+}
+
+// wildcardPath returns the absolute path matched by the route wildcard.
+func wildcardPath(ctx *fiber.Ctx) string {
 	path := ctx.Params("*", "/")
 
 	if path != "/" {
 		path = "/" + path
 	}
 
-	rawFiles, err := s.datastore.ListFiles(context.Background(), path)
-	if err != nil {
-		log.Error(err)
-		return fiber.ErrInternalServerError
+	return cleanPath(path)
+}
+
+func newDirListing(page *catalog.Page) DirListing {
+	listing := DirListing{Items: []DisplayMetadata{}, NextCursor: page.NextCursor}
+
+	for _, file := range page.Files {
+		listing.Items = append(listing.Items, newDisplayMetadata(file))
 	}
 
-	var list []DisplayMetadata
+	return listing
+}
+
+func (s *Server) Dir(ctx *fiber.Ctx) error {
+	path := wildcardPath(ctx)
 
-	for _, file := range rawFiles {
-		if file.FileName == "/" {
-			continue
+	query := catalog.Query{Path: path, Kind: catalog.Kind(ctx.Query("type"))}
+	if !query.Kind.Valid() {
+		return fiber.NewError(http.StatusBadRequest, "type must be file or dir")
+	}
+
+	if processing := ctx.Query("processing"); processing != "" {
+		value, err := strconv.ParseBool(processing)
+		if err != nil {
+			return fiber.NewError(http.StatusBadRequest, "processing must be a boolean")
 		}
+		query.Processing = &value
+	}
 
-		list = append(list, DisplayMetadata{
-			ID:           file.Id,
-			FileName:     file.FileName,
-			Size:         humanize.IBytes(uint64(file.FileSize)),
-			IsDirectory:  file.IsDirectory,
-			IsProcessing: file.IsHidden,
-			Path:         filepath.Join(path, file.FileName),
-		})
+	opts, err := listOptions(ctx)
+	if err != nil {
+		return err
 	}
-	if jsonEncodeErr := ctx.JSON(list); jsonEncodeErr != nil {
+
+	page, err := s.list(ctx.Context(), query, opts)
+	if err != nil {
+		return err
+	}
+
+	// the listing stays a bare array for the clients that predate paging,
+	// the cursor of the next page travels in a header.
+	if page.NextCursor != "" {
+		ctx.Set(NextCursorHeader, page.NextCursor)
+	}
+
+	if jsonEncodeErr := ctx.JSON(newDirListing(page).Items); jsonEncodeErr != nil {
 		return fiber.ErrInternalServerError
 	}
 
 	return nil
 }
 
-func (s *Server) CreateDir(ctx context.Context, targetPath string, name string) error {
-	newpath := filepath.Join(targetPath, name)
+func (s *Server) list(ctx context.Context, query catalog.Query, opts catalog.ListOptions) (*catalog.Page, error) {
+	page, err := s.catalog.Find(ctx, query, opts)
+	if errors.Is(err, catalog.ErrInvalidCursor) {
+		return nil, fiber.NewError(http.StatusBadRequest, err.Error())
+	} else if err != nil {
+		log.Error(err)
+		return nil, fiber.ErrInternalServerError
+	}
+
+	return page, nil
+}
 
-	_, exists := s.datastore.GetMetadataByPath(ctx, newpath)
-	if exists {
-		return errors.New("file exists")
+func listOptions(ctx *fiber.Ctx) (catalog.ListOptions, error) {
+	opts := catalog.ListOptions{
+		Sort:   catalog.SortField(ctx.Query("sort", string(catalog.SortName))),
+		Limit:  int64(ctx.QueryInt("limit", catalog.DefaultLimit)),
+		Cursor: ctx.Query("cursor"),
 	}
 
-	_, err := s.datastore.WriteFile(ctx, models.FileMetadata{
-		Id:          primitive.NewObjectID(),
-		FileName:    name,
-		IsDirectory: true,
-		Path:        targetPath,
-		IsHidden:    false,
-	})
-	if err != nil {
-		return err
+	switch ctx.Query("order", "asc") {
+	case "asc":
+	case "desc":
+		opts.Descending = true
+	default:
+		return opts, fiber.NewError(http.StatusBadRequest, "order must be asc or desc")
 	}
+
+	return opts, checkListOptions(opts)
+}
+
+func checkListOptions(opts catalog.ListOptions) error {
+	if !opts.Sort.Valid() {
+		return fiber.NewError(http.StatusBadRequest, "sort must be one of name, size or created")
+	}
+
+	if opts.Limit <= 0 || opts.Limit > catalog.MaxLimit {
+		return fiber.NewError(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", catalog.MaxLimit))
+	}
+
 	return nil
 }
 
+func (s *Server) CreateDir(ctx context.Context, targetPath string, name string) error {
+	_, _, err := s.makeDir(ctx, targetPath, name, ConflictFail)
+	return err
+}
+
+// ensureDir creates every missing directory on the way to path, like
+// mkdir -p. An existing ancestor that is a file fails with 409.
+func (s *Server) ensureDir(ctx context.Context, path string) error {
+	for _, dir := range getPathSegments(path) {
+		existing, exists := s.datastore.GetMetadataByPath(ctx, dir)
+		if exists {
+			if !existing.IsDirectory {
+				return conflictError(fmt.Sprintf("%s is a file", dir))
+			}
+			continue
+		}
+
+		if _, _, err := s.makeDir(ctx, filepath.Dir(dir), filepath.Base(dir), ConflictSkip); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// makeDir creates the directory name under targetPath and reports whether it
+// was created. A directory that already exists is returned as is with the
+// overwrite and skip policies.
+func (s *Server) makeDir(ctx context.Context, targetPath string, name string, policy ConflictPolicy,
+) (*models.FileMetadata, bool, error) {
+	existing, exists := s.datastore.GetMetadataByPath(ctx, filepath.Join(targetPath, name))
+	if exists && existing.IsDirectory && (policy == ConflictOverwrite || policy == ConflictSkip) {
+		return existing, false, nil
+	}
+
+	metadata := models.FileMetadata{
+		Id:           primitive.NewObjectID(),
+		FileName:     name,
+		CreationTime: time.Now().Unix(),
+		IsDirectory:  true,
+		Path:         targetPath,
+		IsHidden:     false,
+	}
+
+	_, replaces, err := s.create(ctx, &metadata, policy)
+	if errors.Is(err, errSkipped) {
+		// the name may have been taken after the lookup above.
+		existing, exists = s.datastore.GetMetadataByPath(ctx, filepath.Join(targetPath, name))
+		if !exists {
+			return nil, false, conflictError(fmt.Sprintf("%s changed while it was created", filepath.Join(targetPath, name)))
+		}
+
+		return existing, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	if err = s.replace(ctx, &metadata, replaces); err != nil {
+		s.discard(&metadata)
+		return nil, false, err
+	}
+
+	return &metadata, true, nil
+}
+
+// mkdirFallback is the conflict policy of a mkdir that doesn't name one,
+// like mkdir -p an existing directory is fine when creating parents.
+func mkdirFallback(parents bool) ConflictPolicy {
+	if parents {
+		return ConflictSkip
+	}
+
+	return ConflictFail
+}
+
 func (s *Server) Mkdir(ctx *fiber.Ctx) error {
 	name := ctx.FormValue("name")
 	if name == "" {
-		return errors.New("name cant be empty")
+		return fiber.NewError(http.StatusBadRequest, "name cant be empty")
 	}
 
-	targetPath := ctx.FormValue("path", "/")
+	name = sanitizeFilename(name)
+
+	targetPath := cleanPath(ctx.FormValue("path", "/"))
 
 	valid := validatePath(targetPath)
 	if !valid {
-		return fiber.NewError(http.StatusBadRequest, "the provided path is not valid")
+		return errInvalidPath
 	}
 
-	err := s.CreateDir(ctx.Context(), targetPath, name)
+	parents, err := formBool(ctx, "parents")
 	if err != nil {
-		return fiber.NewError(http.StatusBadRequest, err.Error())
+		return err
 	}
 
-	ctx.Status(http.StatusCreated)
-	return nil
+	policy, err := conflictPolicy(ctx, mkdirFallback(parents))
+	if err != nil {
+		return err
+	}
+
+	if parents {
+		if err = s.ensureDir(ctx.Context(), targetPath); err != nil {
+			return err
+		}
+	}
+
+	metadata, created, err := s.makeDir(ctx.Context(), targetPath, name, policy)
+	if err != nil {
+		return err
+	}
+
+	versioned, err := formBool(ctx, "versioning")
+	if err != nil {
+		return err
+	}
+
+	if versioned && created {
+		if err = s.catalog.SetVersioning(ctx.Context(), metadata.Id.Hex(), true); err != nil {
+			log.Error(err)
+			return fiber.ErrInternalServerError
+		}
+	}
+
+	if created {
+		ctx.Status(http.StatusCreated)
+	}
+
+	return ctx.JSON(newDisplayMetadata(*metadata))
 }
 
 func (s *Server) Move(ctx *fiber.Ctx) error {
@@ -106,27 +290,27 @@ func (s *Server) Move(ctx *fiber.Ctx) error {
 
 	metadata, exists := s.datastore.GetMetadataByID(ctx.Context(), id)
 	if !exists {
-		return fiber.NewError(http.StatusNotFound, "file not found")
+		return notFoundError("file not found")
 	}
 
-	newpath := ctx.FormValue("newpath")
+	newpath := cleanPath(ctx.FormValue("newpath"))
 	if newpath == "" {
 		return fiber.NewError(http.StatusBadRequest, "newpath cant be empty")
 	}
 
 	valid := validatePath(newpath)
 	if !valid {
-		return fiber.NewError(http.StatusBadRequest, "the provided path is not valid")
+		return errInvalidPath
 	}
 
-	// TODO: validate that the target path exists
-
-	err := s.datastore.UpdateField(ctx.Context(), metadata.Id.Hex(), "path", newpath)
+	policy, err := conflictPolicy(ctx, ConflictRename)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	newName := sanitizeFilename(ctx.FormValue("new_name", metadata.FileName))
+
+	return s.move(ctx.Context(), metadata, newpath, newName, policy)
 }
 
 func (s *Server) Rename(ctx *fiber.Ctx) error {
@@ -134,7 +318,7 @@ func (s *Server) Rename(ctx *fiber.Ctx) error {
 
 	metadata, exists := s.datastore.GetMetadataByID(ctx.Context(), id)
 	if !exists {
-		return fiber.NewError(http.StatusNotFound, "file not found")
+		return notFoundError("file not found")
 	}
 
 	newName := ctx.FormValue("new_name")
@@ -142,12 +326,51 @@ func (s *Server) Rename(ctx *fiber.Ctx) error {
 		return fiber.NewError(http.StatusBadRequest, "new_name cant be empty")
 	}
 
-	newName = s.fixFilename(ctx.Context(), newName, metadata.Path)
-
-	err := s.datastore.UpdateField(ctx.Context(), metadata.Id.Hex(), "name", newName)
+	policy, err := conflictPolicy(ctx, ConflictRename)
 	if err != nil {
 		return err
 	}
 
+	return s.move(ctx.Context(), metadata, metadata.Path, sanitizeFilename(newName), policy)
+}
+
+// move gives a file a new path and name, resolving a clash at the
+// destination by the policy. A file it overwrites is only deleted once the
+// move is known to succeed.
+func (s *Server) move(ctx context.Context, metadata *models.FileMetadata, newPath string, newName string,
+	policy ConflictPolicy,
+) error {
+	newName, overwrite, err := s.resolveConflict(ctx, newPath, newName, policy, metadata.Id)
+	if errors.Is(err, errSkipped) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if newPath == metadata.Path && newName == metadata.FileName {
+		return nil
+	}
+
+	if !overwrite {
+		return s.relocate(ctx, metadata, newPath, newName)
+	}
+
+	staged := stagedName(newName, metadata.Id)
+	if err = s.relocate(ctx, metadata, newPath, staged); err != nil {
+		return err
+	}
+
+	oldPath, oldName := metadata.Path, metadata.FileName
+	metadata.Path, metadata.FileName = newPath, staged
+
+	if err = s.replace(ctx, metadata, newName); err != nil {
+		// the file goes back to where it was instead of staying staged.
+		if restoreErr := s.relocate(context.Background(), metadata, oldPath, oldName); restoreErr != nil {
+			log.Error("could not move ", filepath.Join(newPath, staged), " back: ", restoreErr)
+		}
+
+		return err
+	}
+
 	return nil
 }
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	ds "dss-main/storage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// rangeReader limits a fragment reader to a byte range and still closes it.
+type rangeReader struct {
+	io.Reader
+	io.Closer
+}
+
+// Download streams the content of a file, a Range header selects a single
+// byte range of it so interrupted downloads can be resumed.
+func (s *Server) Download(ctx *fiber.Ctx) error {
+	metadata, exists := s.datastore.GetMetadataByID(ctx.Context(), ctx.Params("id"))
+	if !exists {
+		return notFoundError("file not found")
+	}
+
+	if metadata.IsDirectory {
+		return fiber.NewError(http.StatusBadRequest, "directories cant be downloaded, use the archive endpoint")
+	}
+
+	if isProcessing(metadata) {
+		return conflictError("the file is still being uploaded")
+	}
+
+	start, length, partial, ok := byteRange(ctx.Get(fiber.HeaderRange), metadata.FileSize)
+	if !ok {
+		ctx.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", metadata.FileSize))
+		return fiber.NewError(http.StatusRequestedRangeNotSatisfiable, "the range is outside of the file")
+	}
+
+	ctx.Set(fiber.HeaderAcceptRanges, "bytes")
+	ctx.Attachment(metadata.FileName)
+
+	if partial {
+		ctx.Status(http.StatusPartialContent)
+		ctx.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, metadata.FileSize))
+	}
+
+	if length == 0 {
+		return ctx.Send(nil)
+	}
+
+	reader, err := ds.ReadFragmentsAt(ctx.Context(), s.storage, metadata.Fragments, start)
+	if err != nil {
+		return upstreamError("could not read the fragments", err)
+	}
+
+	return ctx.SendStream(rangeReader{Reader: io.LimitReader(reader, length), Closer: reader}, int(length))
+}
+
+// byteRange resolves a Range header against a file of size bytes. Headers
+// that aren't a single byte range are ignored and the whole file is served,
+// ok is false when the range starts past the end of the file.
+func byteRange(header string, size int64) (start int64, length int64, partial bool, ok bool) {
+	if !strings.HasPrefix(header, "bytes=") || strings.Contains(header, ",") {
+		return 0, size, false, true
+	}
+
+	first, last, found := strings.Cut(strings.TrimSpace(strings.TrimPrefix(header, "bytes=")), "-")
+	if !found {
+		return 0, size, false, true
+	}
+
+	if first == "" {
+		// a suffix range, the last bytes of the file.
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix < 0 {
+			return 0, size, false, true
+		}
+
+		if suffix == 0 || size == 0 {
+			return 0, 0, false, false
+		}
+
+		if suffix > size {
+			suffix = size
+		}
+
+		return size - suffix, suffix, true, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, size, false, true
+	}
+
+	if start >= size {
+		return 0, 0, false, false
+	}
+
+	end := size - 1
+
+	if last != "" {
+		parsed, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || parsed < start {
+			return 0, size, false, true
+		}
+
+		if parsed < end {
+			end = parsed
+		}
+	}
+
+	return start, end - start + 1, true, true
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrorCode is the kind of an error of the api, clients should branch on it
+// rather than on the message.
+type ErrorCode string
+
+const (
+	CodeInvalidRequest      ErrorCode = "invalid_request"
+	CodeInvalidPath         ErrorCode = "invalid_path"
+	CodeUnauthorized        ErrorCode = "unauthorized"
+	CodeForbidden           ErrorCode = "forbidden"
+	CodeNotFound            ErrorCode = "not_found"
+	CodeConflict            ErrorCode = "conflict"
+	CodeQuotaExceeded       ErrorCode = "quota_exceeded"
+	CodeRangeNotSatisfiable ErrorCode = "range_not_satisfiable"
+	CodeMethodNotAllowed    ErrorCode = "method_not_allowed"
+	CodeUpstreamFailure     ErrorCode = "upstream_failure"
+	CodeInternal            ErrorCode = "internal"
+)
+
+// Error is an error of the domain, it carries the status and the code it is
+// answered with. The cause is logged but never sent to the client.
+type Error struct {
+	Status  int
+	Code    ErrorCode
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+var errInvalidPath = invalidPathError("the provided path is not valid")
+
+// errSizeMismatch rejects a body that is shorter or longer than its declared
+// size.
+var errSizeMismatch = &Error{
+	Status:  http.StatusBadRequest,
+	Code:    CodeInvalidRequest,
+	Message: "the body doesn't match its declared size",
+}
+
+func notFoundError(message string) error {
+	return &Error{Status: http.StatusNotFound, Code: CodeNotFound, Message: message}
+}
+
+func conflictError(message string) error {
+	return &Error{Status: http.StatusConflict, Code: CodeConflict, Message: message}
+}
+
+func invalidPathError(message string) error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeInvalidPath, Message: message}
+}
+
+func unauthorizedError(message string) error {
+	return &Error{Status: http.StatusUnauthorized, Code: CodeUnauthorized, Message: message}
+}
+
+func forbiddenError(message string) error {
+	return &Error{Status: http.StatusForbidden, Code: CodeForbidden, Message: message}
+}
+
+func quotaError(message string) error {
+	return &Error{Status: http.StatusRequestEntityTooLarge, Code: CodeQuotaExceeded, Message: message}
+}
+
+// upstreamError is a failure of a service the server depends on, like the
+// storage or the fragment queue.
+func upstreamError(message string, err error) error {
+	return &Error{Status: http.StatusBadGateway, Code: CodeUpstreamFailure, Message: message, Err: err}
+}
+
+// asError returns the domain error of any error a handler returns. Errors of
+// fiber keep their status, anything else is an internal error.
+func asError(err error) *Error {
+	var domainErr *Error
+	if errors.As(err, &domainErr) {
+		return domainErr
+	}
+
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return &Error{Status: fiberErr.Code, Code: statusCode(fiberErr.Code), Message: fiberErr.Message}
+	}
+
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "internal error", Err: err}
+}
+
+func statusCode(status int) ErrorCode {
+	switch status {
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodeQuotaExceeded
+	case http.StatusRequestedRangeNotSatisfiable:
+		return CodeRangeNotSatisfiable
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return CodeUpstreamFailure
+	}
+
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+
+	return CodeInvalidRequest
+}
+
+// ErrorResponse is the body of every error response of the rest api.
+type ErrorResponse struct {
+	Code      ErrorCode `json:"code"`
+	Message   string    `json:"message"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// ErrorHandler answers the errors of the handlers with an ErrorResponse,
+// server side failures are logged with their cause.
+func ErrorHandler(ctx *fiber.Ctx, err error) error {
+	apiErr := asError(err)
+	requestID := ctx.GetRespHeader(fiber.HeaderXRequestID)
+
+	if apiErr.Status >= http.StatusInternalServerError {
+		log.WithField("request_id", requestID).Error(err)
+	}
+
+	return ctx.Status(apiErr.Status).JSON(ErrorResponse{
+		Code:      apiErr.Code,
+		Message:   apiErr.Message,
+		RequestID: requestID,
+	})
+}
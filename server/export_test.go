@@ -0,0 +1,34 @@
+package server
+
+import (
+	"context"
+	"io"
+
+	"dss-main/dsspb"
+	ds "dss-main/storage"
+)
+
+// GRPCError exposes grpcError to the external tests.
+var GRPCError = grpcError
+
+// NewUploadReader exposes the reader of gRPC upload chunks to the external
+// tests.
+func NewUploadReader(stream dsspb.Storage_UploadServer) io.Reader {
+	return &uploadReader{stream: stream}
+}
+
+// SetStorage replaces the client fragments are read with.
+func SetStorage(s *Server, client ds.Client) {
+	s.storage = client
+}
+
+// SetPublisher makes the server queue fragments to pub.
+func SetPublisher(s *Server, pub publisher) {
+	s.connect = func() (publisher, error) { return pub, nil }
+}
+
+// Fragment exposes publishing an upload of a known size.
+func Fragment(s *Server, size int64, src io.Reader, id string) error {
+	_, err := s.fragment(context.Background(), size, src, id)
+	return err
+}
@@ -0,0 +1,311 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	formatTar = "tar"
+
+	// an archive is extracted up to extractLimit bytes and extractMaxEntries
+	// entries, so a small archive can't expand into an unbounded tree.
+	extractLimit      = 20 << 30
+	extractMaxEntries = 10000
+)
+
+// extractBudget counts what an archive expanded to so far.
+type extractBudget struct {
+	entries int
+	bytes   int64
+}
+
+// add accounts for an entry of size bytes, it fails once the archive is
+// past one of the limits.
+func (b *extractBudget) add(size int64) error {
+	b.entries++
+	b.bytes += size
+
+	// a zip can declare a size that overflows an int64.
+	if size < 0 || b.bytes < 0 || b.bytes > extractLimit {
+		return fmt.Errorf("the archive expands to more than %s", humanize.IBytes(extractLimit))
+	}
+
+	if b.entries > extractMaxEntries {
+		return fmt.Errorf("the archive has more than %d entries", extractMaxEntries)
+	}
+
+	return nil
+}
+
+func archiveFormat(ctx *fiber.Ctx, filename string) (string, error) {
+	format := ctx.FormValue("format")
+	if format == "" {
+		lower := strings.ToLower(filename)
+
+		switch {
+		case strings.HasSuffix(lower, ".zip"):
+			format = formatZip
+		case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+			format = formatTarGz
+		case strings.HasSuffix(lower, ".tar"):
+			format = formatTar
+		}
+	}
+
+	if format != formatZip && format != formatTar && format != formatTarGz {
+		return "", fiber.NewError(http.StatusBadRequest, "the archive must be a zip, tar or tar.gz")
+	}
+
+	return format, nil
+}
+
+// extractUpload expands an uploaded archive into the target path in the
+// background, progress is reported through the job it returns.
+func (s *Server) extractUpload(ctx *fiber.Ctx, file *multipart.FileHeader, template upload) error {
+	format, err := archiveFormat(ctx, file.Filename)
+	if err != nil {
+		return err
+	}
+
+	// the uploaded file is gone once the handler returns, keep a copy.
+	staged, err := os.CreateTemp("", "dss-extract-*")
+	if err != nil {
+		log.Error(err)
+		return fiber.ErrInternalServerError
+	}
+
+	if err = staged.Close(); err != nil {
+		log.Error(err)
+		return fiber.ErrInternalServerError
+	}
+
+	if err = ctx.SaveFile(file, staged.Name()); err != nil {
+		log.Error(err)
+		return fiber.ErrInternalServerError
+	}
+
+	jobID := s.jobs.start("extract")
+
+	go func() {
+		defer func() {
+			if removeErr := os.Remove(staged.Name()); removeErr != nil {
+				log.Error(removeErr)
+			}
+		}()
+
+		// the job runs outside of the recover middleware, a panic would take
+		// the whole server down.
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				log.Error("extracting ", file.Filename, " panicked: ", recovered)
+				s.jobs.finish(jobID, errors.New("internal error"))
+			}
+		}()
+
+		err := s.extract(context.Background(), jobID, staged.Name(), format, template)
+		if err != nil {
+			log.Error("extracting ", file.Filename, " failed: ", err)
+		}
+
+		s.jobs.finish(jobID, err)
+	}()
+
+	return ctx.Status(http.StatusAccepted).JSON(fiber.Map{"job": jobID})
+}
+
+func (s *Server) extract(ctx context.Context, jobID string, archive string, format string, template upload) error {
+	// every entry is published through a single connection.
+	pub, err := s.connect()
+	if err != nil {
+		return err
+	}
+
+	defer pub.Close()
+
+	ctx = context.WithValue(ctx, publisherKey{}, pub)
+
+	if format == formatZip {
+		return s.extractZip(ctx, jobID, archive, template)
+	}
+
+	return s.extractTar(ctx, jobID, archive, format == formatTarGz, template)
+}
+
+func (s *Server) extractZip(ctx context.Context, jobID string, archive string, template upload) error {
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return fmt.Errorf("could not read the zip: %w", err)
+	}
+
+	defer func(reader *zip.ReadCloser) {
+		if closeErr := reader.Close(); closeErr != nil {
+			log.Error(closeErr)
+		}
+	}(reader)
+
+	budget := &extractBudget{}
+
+	for _, file := range reader.File {
+		if err = budget.add(int64(file.UncompressedSize64)); err != nil {
+			return err
+		}
+
+		if file.FileInfo().IsDir() {
+			s.extractDir(ctx, jobID, file.Name, template)
+			continue
+		}
+
+		content, openErr := file.Open()
+		if openErr != nil {
+			s.jobs.addEntry(jobID, JobEntry{Path: file.Name, State: EntryFailed, Error: openErr.Error()})
+			continue
+		}
+
+		s.extractFile(ctx, jobID, file.Name, int64(file.UncompressedSize64), content, template)
+
+		if closeErr := content.Close(); closeErr != nil {
+			log.Error(closeErr)
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) extractTar(ctx context.Context, jobID string, archive string, compressed bool, template upload) error {
+	file, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+
+	defer func(file *os.File) {
+		if closeErr := file.Close(); closeErr != nil {
+			log.Error(closeErr)
+		}
+	}(file)
+
+	var content io.Reader = file
+
+	if compressed {
+		gzipReader, gzipErr := gzip.NewReader(file)
+		if gzipErr != nil {
+			return fmt.Errorf("could not read the gzip stream: %w", gzipErr)
+		}
+		defer gzipReader.Close()
+
+		content = gzipReader
+	}
+
+	reader := tar.NewReader(content)
+	budget := &extractBudget{}
+
+	for {
+		header, nextErr := reader.Next()
+		if errors.Is(nextErr, io.EOF) {
+			return nil
+		} else if nextErr != nil {
+			return fmt.Errorf("could not read the tar: %w", nextErr)
+		}
+
+		if err = budget.add(header.Size); err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			s.extractDir(ctx, jobID, header.Name, template)
+		case tar.TypeReg:
+			s.extractFile(ctx, jobID, header.Name, header.Size, reader, template)
+		default:
+			s.jobs.addEntry(jobID, JobEntry{
+				Path:  header.Name,
+				State: EntrySkipped,
+				Error: "only files and directories are extracted",
+			})
+		}
+	}
+}
+
+// entryPath maps the name of an archive entry to an absolute path under
+// root, a name can't climb out of root with .. segments.
+func entryPath(root string, name string) (string, bool) {
+	cleaned := path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	if cleaned == "/" {
+		return "", false
+	}
+
+	full := root
+	for _, segment := range strings.Split(strings.TrimPrefix(cleaned, "/"), "/") {
+		full = filepath.Join(full, sanitizeFilename(segment))
+	}
+
+	return full, true
+}
+
+func (s *Server) extractDir(ctx context.Context, jobID string, name string, template upload) {
+	entry := JobEntry{Path: name, State: EntryDone}
+
+	full, ok := entryPath(template.path, name)
+	if !ok {
+		return
+	}
+
+	if err := s.ensureDir(ctx, full); err != nil {
+		entry.State = EntryFailed
+		entry.Error = err.Error()
+	}
+
+	s.jobs.addEntry(jobID, entry)
+}
+
+func (s *Server) extractFile(ctx context.Context, jobID string, name string, size int64, content io.Reader,
+	template upload,
+) {
+	entry := JobEntry{Path: name, State: EntryDone}
+	defer func() { s.jobs.addEntry(jobID, entry) }()
+
+	full, ok := entryPath(template.path, name)
+	if !ok {
+		entry.State = EntrySkipped
+		entry.Error = "the entry has no name"
+		return
+	}
+
+	dir := filepath.Dir(full)
+	if err := s.ensureDir(ctx, dir); err != nil {
+		entry.State = EntryFailed
+		entry.Error = err.Error()
+		return
+	}
+
+	file := template
+	file.path = dir
+	file.name = filepath.Base(full)
+	file.size = size
+
+	result, err := s.store(ctx, file, content)
+	entry.ID = result.ID
+
+	if errors.Is(err, errSkipped) {
+		entry.State = EntrySkipped
+		entry.Error = err.Error()
+	} else if err != nil {
+		entry.State = EntryFailed
+		entry.Error = err.Error()
+	}
+}
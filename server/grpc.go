@@ -0,0 +1,439 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+
+	"dss-main/catalog"
+	"dss-main/dsspb"
+	ds "dss-main/storage"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/yakiroren/dss-common/models"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcChunkSize is the most content a single download message carries.
+const grpcChunkSize = 256 * 1024
+
+// grpcService serves the dsspb.Storage api with the same operations as the
+// REST handlers.
+type grpcService struct {
+	dsspb.UnimplementedStorageServer
+
+	server *Server
+}
+
+// GRPC returns the gRPC implementation of the api.
+func (s *Server) GRPC() dsspb.StorageServer {
+	return &grpcService{server: s}
+}
+
+// GRPCOptions returns the options the gRPC server of the api needs, calls
+// carry their credentials in the authorization metadata like an
+// Authorization header.
+func (s *Server) GRPCOptions() []grpc.ServerOption {
+	if s.auth == nil {
+		return nil
+	}
+
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, request any, _ *grpc.UnaryServerInfo,
+			handler grpc.UnaryHandler,
+		) (any, error) {
+			if err := s.grpcAuthenticate(ctx); err != nil {
+				return nil, err
+			}
+
+			return handler(ctx, request)
+		}),
+		grpc.StreamInterceptor(func(service any, stream grpc.ServerStream, _ *grpc.StreamServerInfo,
+			handler grpc.StreamHandler,
+		) error {
+			if err := s.grpcAuthenticate(stream.Context()); err != nil {
+				return err
+			}
+
+			return handler(service, stream)
+		}),
+	}
+}
+
+func (s *Server) grpcAuthenticate(ctx context.Context) error {
+	var authorization string
+	if values := metadata.ValueFromIncomingContext(ctx, "authorization"); len(values) > 0 {
+		authorization = values[0]
+	}
+
+	_, err := s.auth.authenticate(ctx, authorization)
+
+	return grpcError(err)
+}
+
+// grpcError translates the errors of the shared operations into gRPC
+// statuses.
+func grpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+
+	apiErr := asError(err)
+	code := codes.Internal
+
+	switch apiErr.Code {
+	case CodeInvalidRequest, CodeInvalidPath:
+		code = codes.InvalidArgument
+	case CodeUnauthorized:
+		code = codes.Unauthenticated
+	case CodeForbidden:
+		code = codes.PermissionDenied
+	case CodeNotFound:
+		code = codes.NotFound
+	case CodeConflict:
+		code = codes.AlreadyExists
+	case CodeQuotaExceeded:
+		code = codes.ResourceExhausted
+	case CodeRangeNotSatisfiable:
+		code = codes.OutOfRange
+	case CodeUpstreamFailure:
+		code = codes.Unavailable
+	}
+
+	if code == codes.Internal || code == codes.Unavailable {
+		log.Error(err)
+	}
+
+	return status.Error(code, apiErr.Message)
+}
+
+func newFile(metadata *models.FileMetadata) *dsspb.File {
+	return &dsspb.File{
+		Id:           metadata.Id.Hex(),
+		Name:         metadata.FileName,
+		Path:         filepath.Join(metadata.Path, metadata.FileName),
+		Size:         metadata.FileSize,
+		CreationTime: metadata.CreationTime,
+		Directory:    metadata.IsDirectory,
+		Processing:   isProcessing(metadata),
+	}
+}
+
+func (g *grpcService) file(ctx context.Context, id string) (*dsspb.File, error) {
+	metadata, exists := g.server.datastore.GetMetadataByID(ctx, id)
+	if !exists {
+		return nil, status.Error(codes.NotFound, "file not found")
+	}
+
+	return newFile(metadata), nil
+}
+
+// uploadReader reads the content chunks that follow the upload header.
+type uploadReader struct {
+	stream dsspb.Storage_UploadServer
+	chunk  []byte
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		request, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+
+		chunk, ok := request.Content.(*dsspb.UploadRequest_Chunk)
+		if !ok {
+			return 0, status.Error(codes.InvalidArgument, "only the first message can carry a header")
+		}
+
+		r.chunk = chunk.Chunk
+	}
+
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+
+	return n, nil
+}
+
+func (g *grpcService) Upload(stream dsspb.Storage_UploadServer) error {
+	ctx := stream.Context()
+
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	header := first.GetHeader()
+	if header == nil {
+		return status.Error(codes.InvalidArgument, "the first message must carry the header")
+	}
+
+	u, err := g.uploadHeader(ctx, header)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	result, err := g.server.store(ctx, u, &uploadReader{stream: stream})
+	if err != nil && !errors.Is(err, errSkipped) {
+		return grpcError(err)
+	}
+
+	file, err := g.file(ctx, result.ID)
+	if err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(file)
+}
+
+func (g *grpcService) uploadHeader(ctx context.Context, header *dsspb.UploadHeader) (upload, error) {
+	targetPath := cleanPath(header.Path)
+	if targetPath == "" {
+		targetPath = "/"
+	}
+
+	if !validatePath(targetPath) {
+		return upload{}, errInvalidPath
+	}
+
+	if header.Name == "" {
+		return upload{}, fiber.NewError(http.StatusBadRequest, "name cant be empty")
+	}
+
+	size := int64(unknownSize)
+	if header.Size != nil {
+		if *header.Size < 0 {
+			return upload{}, fiber.NewError(http.StatusBadRequest, "size cant be negative")
+		}
+
+		size = *header.Size
+	}
+
+	tags, err := normalizeTags(header.Tags)
+	if err != nil {
+		return upload{}, err
+	}
+
+	policy, err := parseConflictPolicy(header.Conflict, ConflictRename)
+	if err != nil {
+		return upload{}, err
+	}
+
+	if header.Parents {
+		if err = g.server.ensureDir(ctx, targetPath); err != nil {
+			return upload{}, err
+		}
+	}
+
+	versioned := g.server.catalog.Versioning(ctx, targetPath)
+	if header.Versioning != nil {
+		versioned = *header.Versioning
+	}
+
+	return upload{
+		path:      targetPath,
+		name:      header.Name,
+		size:      size,
+		tags:      tags,
+		policy:    policy,
+		versioned: versioned,
+	}, nil
+}
+
+func (g *grpcService) Download(request *dsspb.DownloadRequest, stream dsspb.Storage_DownloadServer) error {
+	ctx := stream.Context()
+
+	metadata, exists := g.server.datastore.GetMetadataByID(ctx, request.Id)
+	if !exists {
+		return status.Error(codes.NotFound, "file not found")
+	}
+
+	if metadata.IsDirectory {
+		return status.Error(codes.InvalidArgument, "directories cant be downloaded")
+	}
+
+	if isProcessing(metadata) {
+		return status.Error(codes.Unavailable, "the file is still being uploaded")
+	}
+
+	if request.Offset < 0 || request.Offset > metadata.FileSize {
+		return status.Error(codes.OutOfRange, "offset is outside of the file")
+	}
+
+	if request.Length < 0 {
+		return status.Error(codes.InvalidArgument, "length cant be negative")
+	}
+
+	length := metadata.FileSize - request.Offset
+	if request.Length > 0 && request.Length < length {
+		length = request.Length
+	}
+
+	if length == 0 {
+		return nil
+	}
+
+	reader, err := ds.ReadFragmentsAt(ctx, g.server.storage, metadata.Fragments, request.Offset)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	defer func() {
+		if closeErr := reader.Close(); closeErr != nil {
+			log.Error(closeErr)
+		}
+	}()
+
+	src := io.LimitReader(reader, length)
+	buffer := make([]byte, grpcChunkSize)
+
+	for {
+		n, err := io.ReadFull(src, buffer)
+		if n > 0 {
+			if sendErr := stream.Send(&dsspb.DownloadResponse{Chunk: buffer[:n]}); sendErr != nil {
+				return sendErr
+			}
+		}
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		} else if err != nil {
+			return grpcError(err)
+		}
+	}
+}
+
+func (g *grpcService) List(ctx context.Context, request *dsspb.ListRequest) (*dsspb.ListResponse, error) {
+	path := cleanPath(request.Path)
+	if path == "" {
+		path = "/"
+	}
+
+	query := catalog.Query{Path: path, Kind: catalog.Kind(request.Type), Processing: request.Processing}
+	if !query.Kind.Valid() {
+		return nil, status.Error(codes.InvalidArgument, "type must be file or dir")
+	}
+
+	opts := catalog.ListOptions{
+		Sort:       catalog.SortField(request.Sort),
+		Descending: request.Descending,
+		Limit:      request.Limit,
+		Cursor:     request.Cursor,
+	}
+
+	if opts.Sort == "" {
+		opts.Sort = catalog.SortName
+	}
+
+	if opts.Limit == 0 {
+		opts.Limit = catalog.DefaultLimit
+	}
+
+	if err := checkListOptions(opts); err != nil {
+		return nil, grpcError(err)
+	}
+
+	page, err := g.server.list(ctx, query, opts)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	response := &dsspb.ListResponse{Items: make([]*dsspb.File, 0, len(page.Files)), NextCursor: page.NextCursor}
+
+	for i := range page.Files {
+		response.Items = append(response.Items, newFile(&page.Files[i]))
+	}
+
+	return response, nil
+}
+
+func (g *grpcService) Mkdir(ctx context.Context, request *dsspb.MkdirRequest) (*dsspb.File, error) {
+	id, err := g.server.runOperation(ctx, BatchOperation{
+		Op:       OpMkdir,
+		Path:     request.Path,
+		Name:     request.Name,
+		Parents:  request.Parents,
+		Conflict: request.Conflict,
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return g.file(ctx, id)
+}
+
+func (g *grpcService) Move(ctx context.Context, request *dsspb.MoveRequest) (*dsspb.File, error) {
+	if request.NewPath == "" {
+		return nil, status.Error(codes.InvalidArgument, "new_path cant be empty")
+	}
+
+	_, err := g.server.runOperation(ctx, BatchOperation{
+		Op:       OpMove,
+		ID:       request.Id,
+		NewPath:  request.NewPath,
+		Conflict: request.Conflict,
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return g.file(ctx, request.Id)
+}
+
+func (g *grpcService) Rename(ctx context.Context, request *dsspb.RenameRequest) (*dsspb.File, error) {
+	_, err := g.server.runOperation(ctx, BatchOperation{
+		Op:       OpRename,
+		ID:       request.Id,
+		NewName:  request.NewName,
+		Conflict: request.Conflict,
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return g.file(ctx, request.Id)
+}
+
+func (g *grpcService) Delete(ctx context.Context, request *dsspb.DeleteRequest) (*dsspb.DeleteResponse, error) {
+	_, err := g.server.runOperation(ctx, BatchOperation{Op: OpDelete, ID: request.Id, Recursive: request.Recursive})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &dsspb.DeleteResponse{}, nil
+}
+
+func (g *grpcService) Status(ctx context.Context, request *dsspb.StatusRequest) (*dsspb.StatusResponse, error) {
+	metadata, exists := g.server.datastore.GetMetadataByID(ctx, request.Id)
+	if !exists {
+		return nil, status.Error(codes.NotFound, "file not found")
+	}
+
+	current := newStatus(metadata)
+
+	response := &dsspb.StatusResponse{
+		State:             current.State,
+		UploadedFragments: int32(current.UploadedFragments),
+	}
+
+	if current.TotalFragments != nil {
+		total := int32(*current.TotalFragments)
+		response.TotalFragments = &total
+	}
+
+	return response, nil
+}
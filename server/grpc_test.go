@@ -0,0 +1,232 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"path"
+	"testing"
+
+	"dss-main/config"
+	"dss-main/dsspb"
+	"dss-main/server"
+	ds "dss-main/storage"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/yakiroren/dss-common/db"
+	"github.com/yakiroren/dss-common/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func Test_grpcError(t *testing.T) {
+	tests := []struct {
+		err  error
+		code codes.Code
+	}{
+		{err: &server.Error{Code: server.CodeNotFound, Message: "file not found"}, code: codes.NotFound},
+		{err: &server.Error{Code: server.CodeConflict, Message: "taken"}, code: codes.AlreadyExists},
+		{err: &server.Error{Code: server.CodeQuotaExceeded, Message: "too large"}, code: codes.ResourceExhausted},
+		{err: fiber.NewError(fiber.StatusBadRequest, "name cant be empty"), code: codes.InvalidArgument},
+		{err: status.Error(codes.OutOfRange, "offset"), code: codes.OutOfRange},
+		{err: context.Canceled, code: codes.Canceled},
+		{err: errors.New("broken"), code: codes.Internal},
+	}
+
+	require.NoError(t, server.GRPCError(nil))
+
+	for _, test := range tests {
+		require.Equal(t, test.code, status.Code(server.GRPCError(test.err)), test.err.Error())
+	}
+}
+
+// uploadStream replays upload requests to the server side of an upload.
+type uploadStream struct {
+	dsspb.Storage_UploadServer
+	requests []*dsspb.UploadRequest
+}
+
+func (s *uploadStream) Recv() (*dsspb.UploadRequest, error) {
+	if len(s.requests) == 0 {
+		return nil, io.EOF
+	}
+
+	request := s.requests[0]
+	s.requests = s.requests[1:]
+
+	return request, nil
+}
+
+func chunk(content string) *dsspb.UploadRequest {
+	return &dsspb.UploadRequest{Content: &dsspb.UploadRequest_Chunk{Chunk: []byte(content)}}
+}
+
+func Test_uploadReader(t *testing.T) {
+	stream := &uploadStream{requests: []*dsspb.UploadRequest{chunk("ab"), chunk(""), chunk("cde")}}
+
+	content, err := io.ReadAll(server.NewUploadReader(stream))
+	require.NoError(t, err)
+	require.Equal(t, "abcde", string(content))
+
+	stream = &uploadStream{requests: []*dsspb.UploadRequest{
+		chunk("ab"),
+		{Content: &dsspb.UploadRequest_Header{Header: &dsspb.UploadHeader{Name: "a"}}},
+	}}
+
+	_, err = io.ReadAll(server.NewUploadReader(stream))
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func Test_uploadShorterThanSize(t *testing.T) {
+	srv := newTestServer(t)
+	server.SetPublisher(srv, &memoryPublisher{})
+
+	// the stream ends after 5 of the 10 bytes the header declared.
+	stream := &uploadStream{requests: []*dsspb.UploadRequest{chunk("abc"), chunk("de")}}
+
+	err := server.Fragment(srv, 10, server.NewUploadReader(stream), "id")
+	require.Equal(t, codes.InvalidArgument, status.Code(server.GRPCError(err)))
+}
+
+// memoryStore serves the metadata of files, any write fails the test by
+// calling the nil DataStore.
+type memoryStore struct {
+	db.DataStore
+	files map[string]*models.FileMetadata
+}
+
+func (s *memoryStore) GetMetadataByID(_ context.Context, id string) (*models.FileMetadata, bool) {
+	file, exists := s.files[id]
+	return file, exists
+}
+
+func (s *memoryStore) GetMetadataByPath(_ context.Context, p string) (*models.FileMetadata, bool) {
+	for _, file := range s.files {
+		if path.Join(file.Path, file.FileName) == p {
+			return file, true
+		}
+	}
+
+	return nil, false
+}
+
+// fragmentStore serves fragments from memory.
+type fragmentStore map[string]string
+
+func (s fragmentStore) ReadFragments(_ context.Context, fragments []models.Fragment) (io.ReadCloser, error) {
+	var content bytes.Buffer
+
+	for _, fragment := range ds.SortFragments(fragments) {
+		content.WriteString(s[fragment.Name])
+	}
+
+	return io.NopCloser(&content), nil
+}
+
+// newTestServer serves files whose fragments 1, 2 and 3 hold "abcdefghij".
+func newTestServer(t *testing.T, files ...*models.FileMetadata) *server.Server {
+	store := &memoryStore{files: map[string]*models.FileMetadata{}}
+	for _, file := range files {
+		store.files[file.Id.Hex()] = file
+	}
+
+	srv, err := server.NewServer(&config.Config{FragmentSize: 4}, store, nil)
+	require.NoError(t, err)
+	server.SetStorage(srv, fragmentStore{"1": "abcd", "2": "efgh", "3": "ij"})
+
+	return srv
+}
+
+func newGRPCClient(t *testing.T, files ...*models.FileMetadata) dsspb.StorageClient {
+	srv := newTestServer(t, files...)
+
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	dsspb.RegisterStorageServer(grpcServer, srv.GRPC())
+
+	go func() {
+		_ = grpcServer.Serve(listener)
+	}()
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, conn.Close()) })
+
+	return dsspb.NewStorageClient(conn)
+}
+
+func download(client dsspb.StorageClient, request *dsspb.DownloadRequest) (string, error) {
+	stream, err := client.Download(context.Background(), request)
+	if err != nil {
+		return "", err
+	}
+
+	var content bytes.Buffer
+
+	for {
+		response, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return content.String(), nil
+		} else if err != nil {
+			return "", err
+		}
+
+		content.Write(response.Chunk)
+	}
+}
+
+func Test_grpcDownload(t *testing.T) {
+	file := &models.FileMetadata{
+		Id:             primitive.NewObjectID(),
+		FileName:       "file",
+		FileSize:       10,
+		TotalFragments: 3,
+		Fragments:      []models.Fragment{{Name: "3", Size: 2}, {Name: "1", Size: 4}, {Name: "2", Size: 4}},
+	}
+	dir := &models.FileMetadata{Id: primitive.NewObjectID(), FileName: "dir", IsDirectory: true}
+	processing := &models.FileMetadata{
+		Id:             primitive.NewObjectID(),
+		FileName:       "processing",
+		FileSize:       10,
+		TotalFragments: 3,
+		Fragments:      []models.Fragment{{Name: "1", Size: 4}},
+	}
+
+	client := newGRPCClient(t, file, dir, processing)
+	id := file.Id.Hex()
+
+	tests := []struct {
+		name    string
+		request *dsspb.DownloadRequest
+		content string
+		code    codes.Code
+	}{
+		{name: "whole file", request: &dsspb.DownloadRequest{Id: id}, content: "abcdefghij"},
+		{name: "range", request: &dsspb.DownloadRequest{Id: id, Offset: 3, Length: 4}, content: "defg"},
+		{name: "range past the end", request: &dsspb.DownloadRequest{Id: id, Offset: 8, Length: 10}, content: "ij"},
+		{name: "offset at the end", request: &dsspb.DownloadRequest{Id: id, Offset: 10}, content: ""},
+		{name: "offset past the end", request: &dsspb.DownloadRequest{Id: id, Offset: 11}, code: codes.OutOfRange},
+		{name: "negative length", request: &dsspb.DownloadRequest{Id: id, Length: -1}, code: codes.InvalidArgument},
+		{name: "missing file", request: &dsspb.DownloadRequest{Id: primitive.NewObjectID().Hex()}, code: codes.NotFound},
+		{name: "directory", request: &dsspb.DownloadRequest{Id: dir.Id.Hex()}, code: codes.InvalidArgument},
+		{name: "processing file", request: &dsspb.DownloadRequest{Id: processing.Id.Hex()}, code: codes.Unavailable},
+	}
+
+	for _, test := range tests {
+		content, err := download(client, test.request)
+		require.Equal(t, test.code, status.Code(err), test.name)
+		require.Equal(t, test.content, content, test.name)
+	}
+}
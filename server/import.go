@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// importLimit caps the size of an imported file, like the body of an upload.
+	importLimit        = 5 << 30
+	importDialTimeout  = 10 * time.Second
+	importReplyTimeout = 30 * time.Second
+	// importTimeout bounds a whole import, including reading the body.
+	importTimeout      = 6 * time.Hour
+	importMaxRedirects = 5
+)
+
+var errPrivateAddress = errors.New("the url resolves to a private address")
+
+// newImportClient returns the client imports are fetched with. It only
+// connects to public addresses, checked after the name was resolved so
+// neither DNS nor redirects can point it at the server's own network.
+func newImportClient() *http.Client {
+	dialer := &net.Dialer{Timeout: importDialTimeout, Control: publicAddress}
+
+	return &http.Client{
+		Timeout: importTimeout,
+		Transport: &http.Transport{
+			// a proxy would be the only address the dialer checks.
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   importDialTimeout,
+			ResponseHeaderTimeout: importReplyTimeout,
+		},
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			if len(via) >= importMaxRedirects {
+				return errors.New("the url redirects too often")
+			}
+
+			if request.URL.Scheme != "http" && request.URL.Scheme != "https" {
+				return errors.New("the url redirects to a scheme other than http or https")
+			}
+
+			return nil
+		},
+	}
+}
+
+// publicAddress rejects connections to loopback, private, link local and
+// other addresses that aren't reachable from the internet.
+func publicAddress(_ string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublic(ip) {
+		return errPrivateAddress
+	}
+
+	return nil
+}
+
+// sharedAddressSpace is the carrier grade NAT range, which net.IP doesn't
+// count as private.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isPublic(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// Import stores a file that is served over http, the remote body is streamed
+// into the fragment pipeline in the background and its progress is reported
+// by Status.
+func (s *Server) Import(ctx *fiber.Ctx) error {
+	source, err := url.Parse(ctx.FormValue("url"))
+	if err != nil || (source.Scheme != "http" && source.Scheme != "https") || source.Host == "" {
+		return fiber.NewError(http.StatusBadRequest, "url must be an absolute http or https url")
+	}
+
+	targetPath := cleanPath(ctx.FormValue("path", "/"))
+	if !validatePath(targetPath) {
+		return errInvalidPath
+	}
+
+	tags, err := parseTags(ctx)
+	if err != nil {
+		return err
+	}
+
+	parents, err := formBool(ctx, "parents")
+	if err != nil {
+		return err
+	}
+
+	if parents {
+		if err = s.ensureDir(ctx.Context(), targetPath); err != nil {
+			return err
+		}
+	}
+
+	versioned, err := s.versioned(ctx, targetPath)
+	if err != nil {
+		return err
+	}
+
+	policy, err := conflictPolicy(ctx, ConflictRename)
+	if err != nil {
+		return err
+	}
+
+	// the body is read after the handler returns, so the request context
+	// can't bound the download.
+	request, err := http.NewRequestWithContext(context.Background(), http.MethodGet, source.String(), http.NoBody)
+	if err != nil {
+		return fiber.NewError(http.StatusBadRequest, "url must be an absolute http or https url")
+	}
+
+	response, err := s.importClient.Do(request)
+	if errors.Is(err, errPrivateAddress) {
+		return fiber.NewError(http.StatusBadRequest, "url must point to a public address")
+	} else if err != nil {
+		return upstreamError("could not reach the url", err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		closeBody(response.Body)
+		return upstreamError(fmt.Sprintf("the url responded with %s", response.Status), nil)
+	}
+
+	if response.ContentLength > importLimit {
+		closeBody(response.Body)
+		return tooLarge(importLimit)
+	}
+
+	// a Content-Length of -1 means the size is computed once the body ends.
+	registered, err := s.register(ctx.Context(), upload{
+		path:      targetPath,
+		name:      importName(ctx.FormValue("name"), response, source),
+		size:      response.ContentLength,
+		tags:      tags,
+		policy:    policy,
+		versioned: versioned,
+	})
+	if errors.Is(err, errSkipped) {
+		closeBody(response.Body)
+		return ctx.Status(http.StatusOK).SendString(registered.ID)
+	} else if err != nil {
+		closeBody(response.Body)
+		return err
+	}
+
+	log.Info("importing ", source.Redacted(), " as ", registered.ID)
+
+	go func() {
+		defer closeBody(response.Body)
+
+		background := context.Background()
+
+		body := newLimitedReader(response.Body, importLimit)
+
+		publishErr := s.publish(background, registered.ID, response.ContentLength, body)
+		publishErr = s.complete(background, registered, publishErr)
+		if publishErr != nil {
+			log.Error("import of ", source.Redacted(), " failed: ", publishErr)
+		}
+	}()
+
+	return ctx.Status(http.StatusAccepted).SendString(registered.ID)
+}
+
+// importName picks the name of an imported file, the explicit name comes
+// first, then the name the server suggests and last the end of the url.
+func importName(name string, response *http.Response, source *url.URL) string {
+	if name != "" {
+		return name
+	}
+
+	_, params, err := mime.ParseMediaType(response.Header.Get("Content-Disposition"))
+	if err == nil && params["filename"] != "" {
+		return path.Base(params["filename"])
+	}
+
+	return path.Base(source.Path)
+}
+
+func closeBody(body io.ReadCloser) {
+	if err := body.Close(); err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+
+	EntryDone    = "done"
+	EntryFailed  = "failed"
+	EntrySkipped = "skipped"
+
+	// finished jobs are forgotten after jobRetention, or sooner once more
+	// than jobMaxFinished of them are kept.
+	jobRetention   = 24 * time.Hour
+	jobMaxFinished = 1000
+)
+
+type JobEntry struct {
+	Path  string `json:"path"`
+	ID    string `json:"id,omitempty"`
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+// Job tracks a long running request, like extracting an uploaded archive.
+type Job struct {
+	ID       string     `json:"id"`
+	Kind     string     `json:"kind"`
+	State    string     `json:"state"`
+	Error    string     `json:"error,omitempty"`
+	Started  int64      `json:"started"`
+	Finished int64      `json:"finished,omitempty"`
+	Entries  []JobEntry `json:"entries"`
+}
+
+// jobRegistry keeps the jobs of this instance in memory.
+type jobRegistry struct {
+	mutex sync.Mutex
+	jobs  map[string]*Job
+}
+
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{jobs: map[string]*Job{}}
+}
+
+func (r *jobRegistry) start(kind string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.forgetFinished()
+
+	job := &Job{
+		ID:      primitive.NewObjectID().Hex(),
+		Kind:    kind,
+		State:   JobRunning,
+		Started: time.Now().Unix(),
+		Entries: []JobEntry{},
+	}
+	r.jobs[job.ID] = job
+
+	return job.ID
+}
+
+func (r *jobRegistry) addEntry(id string, entry JobEntry) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if job, found := r.jobs[id]; found {
+		job.Entries = append(job.Entries, entry)
+	}
+}
+
+func (r *jobRegistry) finish(id string, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	job, found := r.jobs[id]
+	if !found {
+		return
+	}
+
+	job.State = JobDone
+	job.Finished = time.Now().Unix()
+
+	if err != nil {
+		job.State = JobFailed
+		job.Error = err.Error()
+	}
+
+	r.forgetFinished()
+}
+
+// get returns a copy of the job, safe to use while it keeps running.
+func (r *jobRegistry) get(id string) (Job, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	job, found := r.jobs[id]
+	if !found {
+		return Job{}, false
+	}
+
+	snapshot := *job
+	snapshot.Entries = append([]JobEntry{}, job.Entries...)
+
+	return snapshot, true
+}
+
+func (r *jobRegistry) forgetFinished() {
+	cutoff := time.Now().Add(-jobRetention).Unix()
+
+	var finished []*Job
+
+	for id, job := range r.jobs {
+		if job.State == JobRunning {
+			continue
+		}
+
+		if job.Finished < cutoff {
+			delete(r.jobs, id)
+		} else {
+			finished = append(finished, job)
+		}
+	}
+
+	if len(finished) <= jobMaxFinished {
+		return
+	}
+
+	// the jobs that finished first are forgotten first.
+	sort.Slice(finished, func(i, j int) bool { return finished[i].Finished < finished[j].Finished })
+
+	for _, job := range finished[:len(finished)-jobMaxFinished] {
+		delete(r.jobs, job.ID)
+	}
+}
+
+func (s *Server) JobStatus(ctx *fiber.Ctx) error {
+	job, found := s.jobs.get(ctx.Params("id"))
+	if !found {
+		return notFoundError("job not found")
+	}
+
+	return ctx.JSON(job)
+}
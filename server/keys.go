@@ -0,0 +1,93 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"dss-main/catalog"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIKey is an api key as the admin endpoints show it, the secret is only
+// sent once, when the key is issued.
+type APIKey struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Admin   bool   `json:"admin"`
+	Created int64  `json:"created"`
+	Revoked int64  `json:"revoked,omitempty"`
+	Key     string `json:"key,omitempty"`
+}
+
+func newAPIKeyResponse(key *catalog.APIKey) APIKey {
+	return APIKey{
+		ID:      key.ID.Hex(),
+		Name:    key.Name,
+		Admin:   key.Admin,
+		Created: key.Created,
+		Revoked: key.Revoked,
+	}
+}
+
+// IssueKey creates an api key, the response holds its secret.
+func (s *Server) IssueKey(ctx *fiber.Ctx) error {
+	name := ctx.FormValue("name")
+	if name == "" {
+		return fiber.NewError(http.StatusBadRequest, "name cant be empty")
+	}
+
+	admin, err := formBool(ctx, "admin")
+	if err != nil {
+		return err
+	}
+
+	secret, hash, err := newAPIKey()
+	if err != nil {
+		return err
+	}
+
+	key := &catalog.APIKey{Name: name, Hash: hash, Admin: admin}
+	if err = s.catalog.CreateKey(ctx.Context(), key); err != nil {
+		return err
+	}
+
+	response := newAPIKeyResponse(key)
+	response.Key = secret
+
+	return ctx.Status(http.StatusCreated).JSON(response)
+}
+
+func (s *Server) ListKeys(ctx *fiber.Ctx) error {
+	keys, err := s.catalog.Keys(ctx.Context())
+	if err != nil {
+		return err
+	}
+
+	response := make([]APIKey, 0, len(keys))
+	for i := range keys {
+		response = append(response, newAPIKeyResponse(&keys[i]))
+	}
+
+	return ctx.JSON(response)
+}
+
+// RevokeKey stops a key from working right away.
+func (s *Server) RevokeKey(ctx *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(ctx.Params("id"))
+	if err != nil {
+		return notFoundError("api key not found")
+	}
+
+	err = s.catalog.RevokeKey(ctx.Context(), id)
+	if errors.Is(err, catalog.ErrKeyNotFound) {
+		return notFoundError("api key not found")
+	} else if err != nil {
+		return err
+	}
+
+	ctx.Status(http.StatusOK)
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// ManifestEntry describes a file under the root of a manifest, Path is
+// relative to that root. Checksum is empty for files whose content was
+// stored before checksums were kept, or that are still being uploaded.
+type ManifestEntry struct {
+	ID           interface{} `json:"id"`
+	Path         string      `json:"path"`
+	Bytes        int64       `json:"bytes"`
+	IsDirectory  bool        `json:"directory"`
+	IsProcessing bool        `json:"processing"`
+	Checksum     string      `json:"sha256,omitempty"`
+	ModTime      int64       `json:"mtime,omitempty"`
+}
+
+type Manifest struct {
+	Path  string          `json:"path"`
+	Files []ManifestEntry `json:"files"`
+}
+
+// Manifest lists the whole subtree of a directory with the size, checksum
+// and modification time of every file, which is what a sync compares a
+// local tree against.
+func (s *Server) Manifest(ctx *fiber.Ctx) error {
+	path := wildcardPath(ctx)
+
+	metadata, exists := s.datastore.GetMetadataByPath(ctx.Context(), path)
+	if !exists {
+		return notFoundError("directory not found")
+	}
+
+	if !metadata.IsDirectory {
+		return invalidPathError("the provided path is not a directory")
+	}
+
+	entries, err := s.catalog.Manifest(ctx.Context(), path)
+	if err != nil {
+		log.Error(err)
+		return fiber.ErrInternalServerError
+	}
+
+	manifest := Manifest{Path: path, Files: make([]ManifestEntry, 0, len(entries))}
+	prefix := strings.TrimSuffix(path, "/") + "/"
+
+	for _, entry := range entries {
+		manifest.Files = append(manifest.Files, ManifestEntry{
+			ID:           entry.ID,
+			Path:         strings.TrimPrefix(filepath.Join(entry.Path, entry.Name), prefix),
+			Bytes:        entry.Size,
+			IsDirectory:  entry.IsDirectory,
+			IsProcessing: entry.IsHidden,
+			Checksum:     entry.Checksum,
+			ModTime:      entry.ModTime,
+		})
+	}
+
+	return ctx.JSON(manifest)
+}
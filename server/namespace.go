@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"dss-main/catalog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yakiroren/dss-common/models"
+)
+
+// every handler that changes the namespace goes through insert, create,
+// relocate and remove, which keep it a tree: each entry lives in an existing
+// directory and a name is taken at most once per directory.
+
+const maxCreateAttempts = 5
+
+var errNameTaken = errors.New("the name is already taken")
+
+// checkParent verifies that dir exists and is a directory.
+func (s *Server) checkParent(ctx context.Context, dir string) error {
+	parent, exists := s.datastore.GetMetadataByPath(ctx, dir)
+	if !exists {
+		return notFoundError(fmt.Sprintf("directory %s does not exist", dir))
+	}
+
+	if !parent.IsDirectory {
+		return conflictError(fmt.Sprintf("%s is a file", dir))
+	}
+
+	return nil
+}
+
+func isRoot(metadata models.FileMetadata) bool {
+	return metadata.Path == "/" && metadata.FileName == "/"
+}
+
+// insert writes a new entry, errNameTaken is returned when its name was
+// taken since it was resolved.
+func (s *Server) insert(ctx context.Context, metadata models.FileMetadata) (string, error) {
+	if !isRoot(metadata) {
+		if err := s.checkParent(ctx, metadata.Path); err != nil {
+			return "", err
+		}
+	}
+
+	id, err := s.datastore.WriteFile(ctx, metadata)
+	if catalog.IsNameTaken(err) {
+		return "", errNameTaken
+	}
+
+	return id, err
+}
+
+// create resolves the name of a new entry by the policy and inserts it. Two
+// requests can race for the same free name, the loser of the race is
+// renamed again with the rename policy and fails with 409 otherwise. When
+// the entry overwrites another one it is inserted under a staged name, which
+// is returned along with the name it takes over with replace.
+func (s *Server) create(ctx context.Context, metadata *models.FileMetadata, policy ConflictPolicy,
+) (string, string, error) {
+	for attempt := 1; ; attempt++ {
+		name, overwrite, err := s.resolveConflict(ctx, metadata.Path, metadata.FileName, policy, metadata.Id)
+		if err != nil {
+			return "", "", err
+		}
+
+		metadata.FileName = name
+
+		replaces := ""
+		if overwrite {
+			replaces = name
+			metadata.FileName = stagedName(name, metadata.Id)
+		}
+
+		id, err := s.insert(ctx, *metadata)
+		if errors.Is(err, errNameTaken) {
+			metadata.FileName = name
+
+			if policy == ConflictRename && attempt < maxCreateAttempts {
+				continue
+			}
+
+			return "", "", conflictError(
+				fmt.Sprintf("%s already exists", filepath.Join(metadata.Path, metadata.FileName)))
+		}
+
+		return id, replaces, err
+	}
+}
+
+// relocate gives a file a new path and name. The destination directory
+// must exist, a directory can't be moved under itself, and everything under
+// a moved directory moves along with it.
+func (s *Server) relocate(ctx context.Context, metadata *models.FileMetadata, newPath string, newName string) error {
+	if isRoot(*metadata) {
+		return fiber.NewError(http.StatusBadRequest, "the root directory can't be moved")
+	}
+
+	source := filepath.Join(metadata.Path, metadata.FileName)
+	destination := filepath.Join(newPath, newName)
+
+	if metadata.IsDirectory && (newPath == source || strings.HasPrefix(newPath, source+"/")) {
+		return fiber.NewError(http.StatusBadRequest, "a directory can't be moved into itself")
+	}
+
+	if newPath != metadata.Path {
+		if err := s.checkParent(ctx, newPath); err != nil {
+			return err
+		}
+	}
+
+	err := s.catalog.Relocate(ctx, metadata.Id, newPath, newName)
+	if catalog.IsNameTaken(err) {
+		return conflictError(fmt.Sprintf("%s already exists", destination))
+	} else if err != nil {
+		return err
+	}
+
+	if metadata.IsDirectory && source != destination {
+		return s.catalog.MoveSubtree(ctx, source, destination)
+	}
+
+	return nil
+}
+
+// remove deletes a file along with its archived versions. A directory is
+// only deleted when it is empty, unless recursive is set.
+func (s *Server) remove(ctx context.Context, metadata *models.FileMetadata, recursive bool) error {
+	if isRoot(*metadata) {
+		return fiber.NewError(http.StatusBadRequest, "the root directory can't be deleted")
+	}
+
+	if metadata.IsDirectory {
+		dir := filepath.Join(metadata.Path, metadata.FileName)
+
+		if recursive {
+			if _, err := s.catalog.DeleteSubtree(ctx, dir); err != nil {
+				return err
+			}
+		} else {
+			hasChildren, err := s.catalog.HasChildren(ctx, dir)
+			if err != nil {
+				return err
+			}
+
+			if hasChildren {
+				return conflictError(fmt.Sprintf("directory %s is not empty", dir))
+			}
+		}
+	}
+
+	success := s.datastore.Delete(ctx, metadata.Id.Hex())
+	if !success {
+		return fiber.NewError(http.StatusBadRequest, "could not delete")
+	}
+
+	if _, err := s.catalog.DeleteVersions(ctx, metadata.Id); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,327 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gofiber/fiber/v2"
+)
+
+// wildcardParam is the name of the path parameter standing for the rest of
+// the url, like the * of the fiber routes.
+const wildcardParam = "path"
+
+//go:embed openapi.yaml
+var openapiSpec []byte
+
+// OpenAPI is the description of the rest api. It serves the document and
+// validates requests against it before they reach the handlers.
+type OpenAPI struct {
+	doc      *openapi3.T
+	json     []byte
+	basePath string
+	routes   []specRoute
+	options  *openapi3filter.Options
+}
+
+// specRoute matches the urls of a path of the document.
+type specRoute struct {
+	path     string
+	pathItem *openapi3.PathItem
+	pattern  *regexp.Regexp
+	params   []string
+}
+
+// the form decoder of openapi3filter turns fields missing from a form into
+// nulls, which fail every schema that isn't nullable.
+func init() {
+	decodeForm := openapi3filter.RegisteredBodyDecoder(fiber.MIMEApplicationForm)
+
+	openapi3filter.RegisterBodyDecoder(fiber.MIMEApplicationForm, func(body io.Reader, header http.Header,
+		schema *openapi3.SchemaRef, encoding openapi3filter.EncodingFn,
+	) (any, error) {
+		value, err := decodeForm(body, header, schema, encoding)
+		if form, ok := value.(map[string]any); ok {
+			for name, field := range form {
+				if field == nil {
+					delete(form, name)
+				}
+			}
+		}
+
+		return value, err
+	})
+}
+
+// LoadOpenAPI loads and checks the embedded document.
+func LoadOpenAPI() (*OpenAPI, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(openapiSpec)
+	if err != nil {
+		return nil, fmt.Errorf("loading the openapi document: %w", err)
+	}
+
+	if err = doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid openapi document: %w", err)
+	}
+
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	basePath, err := doc.Servers.BasePath()
+	if err != nil {
+		return nil, err
+	}
+
+	options := &openapi3filter.Options{
+		SkipSettingDefaults: true,
+		AuthenticationFunc:  openapi3filter.NoopAuthenticationFunc,
+	}
+	options.WithCustomSchemaErrorFunc(func(err *openapi3.SchemaError) string {
+		return err.Reason
+	})
+
+	api := &OpenAPI{doc: doc, json: encoded, basePath: basePath, options: options}
+
+	for _, path := range doc.Paths.InMatchingOrder() {
+		route, err := newSpecRoute(path, doc.Paths[path])
+		if err != nil {
+			return nil, err
+		}
+
+		api.routes = append(api.routes, route)
+	}
+
+	return api, nil
+}
+
+// newSpecRoute turns a path of the document into a pattern, a trailing
+// wildcard parameter may be empty and may contain slashes.
+func newSpecRoute(path string, pathItem *openapi3.PathItem) (specRoute, error) {
+	route := specRoute{path: path, pathItem: pathItem}
+
+	var pattern strings.Builder
+	pattern.WriteString("^")
+
+	rest := path
+	for rest != "" {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			pattern.WriteString(regexp.QuoteMeta(rest))
+			break
+		}
+
+		end := strings.IndexByte(rest, '}')
+		if end < start {
+			return route, fmt.Errorf("invalid openapi path %s", path)
+		}
+
+		name := rest[start+1 : end]
+		literal := rest[:start]
+		rest = rest[end+1:]
+
+		if name == wildcardParam && rest == "" {
+			pattern.WriteString(regexp.QuoteMeta(strings.TrimSuffix(literal, "/")) + "(?:/(.*))?")
+		} else {
+			pattern.WriteString(regexp.QuoteMeta(literal) + "([^/]+)")
+		}
+
+		route.params = append(route.params, name)
+	}
+
+	pattern.WriteString("$")
+
+	compiled, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return route, err
+	}
+
+	route.pattern = compiled
+
+	return route, nil
+}
+
+// Spec serves the document as json.
+func (o *OpenAPI) Spec(ctx *fiber.Ctx) error {
+	ctx.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return ctx.Send(o.json)
+}
+
+// Validate checks the parameters of a request, and its body when it is a
+// small form or json, against the operation it is routed to. Requests the
+// document doesn't describe are left to the router.
+func (o *OpenAPI) Validate(ctx *fiber.Ctx) error {
+	route, params := o.find(ctx.Method(), strings.TrimPrefix(ctx.Path(), o.basePath))
+	if route == nil {
+		return ctx.Next()
+	}
+
+	request, validateBody, err := o.request(ctx, route.Operation)
+	if err != nil {
+		return err
+	}
+
+	options := *o.options
+	options.ExcludeRequestBody = !validateBody
+
+	err = openapi3filter.ValidateRequest(ctx.Context(), &openapi3filter.RequestValidationInput{
+		Request:    request,
+		PathParams: params,
+		Route:      route,
+		Options:    &options,
+	})
+	if err != nil {
+		return fiber.NewError(http.StatusBadRequest, validationMessage(err))
+	}
+
+	return ctx.Next()
+}
+
+// find returns the operation of a path relative to the base path, literal
+// segments win over parameters like /tags/bulk over /tags/{id}.
+func (o *OpenAPI) find(method string, path string) (*routers.Route, map[string]string) {
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+
+	var (
+		found  *specRoute
+		values []string
+	)
+
+	for i := range o.routes {
+		route := &o.routes[i]
+
+		match := route.pattern.FindStringSubmatch(path)
+		if match == nil || (found != nil && len(route.params) >= len(found.params)) {
+			continue
+		}
+
+		if route.pathItem.GetOperation(method) != nil {
+			found, values = route, match[1:]
+		}
+	}
+
+	if found == nil {
+		return nil, nil
+	}
+
+	params := make(map[string]string, len(found.params))
+	for i, name := range found.params {
+		params[name] = values[i]
+	}
+
+	if value, ok := params[wildcardParam]; ok {
+		params[wildcardParam] = "/" + value
+	}
+
+	return &routers.Route{
+		Spec:      o.doc,
+		Path:      found.path,
+		PathItem:  found.pathItem,
+		Method:    method,
+		Operation: found.pathItem.GetOperation(method),
+	}, params
+}
+
+// request builds the net/http request the validation reads. Bodies are only
+// read when they are url encoded or json, uploads are streamed to the
+// handlers untouched. Form values may be sent in the query too, so the
+// validated form holds both like ctx.FormValue does.
+func (o *OpenAPI) request(ctx *fiber.Ctx, operation *openapi3.Operation) (*http.Request, bool, error) {
+	target, err := url.ParseRequestURI(string(ctx.Request().URI().RequestURI()))
+	if err != nil {
+		return nil, false, fiber.NewError(http.StatusBadRequest, "the url is not valid")
+	}
+
+	request := &http.Request{
+		Method: ctx.Method(),
+		URL:    target,
+		Header: http.Header{},
+		Body:   http.NoBody,
+	}
+
+	ctx.Request().Header.VisitAll(func(key []byte, value []byte) {
+		request.Header.Add(string(key), string(value))
+	})
+
+	if operation.RequestBody == nil {
+		return request, false, nil
+	}
+
+	content := operation.RequestBody.Value.Content
+	mediaType := strings.TrimSpace(strings.Split(string(ctx.Request().Header.ContentType()), ";")[0])
+
+	var body []byte
+
+	switch {
+	case mediaType == fiber.MIMEApplicationJSON && content.Get(mediaType) != nil:
+		body = ctx.Body()
+	case (mediaType == fiber.MIMEApplicationForm || mediaType == "") && content.Get(fiber.MIMEApplicationForm) != nil:
+		form := url.Values{}
+
+		ctx.Request().PostArgs().VisitAll(func(key []byte, value []byte) {
+			form.Add(string(key), string(value))
+		})
+
+		query := target.Query()
+		for key := range query {
+			form[key] = query[key]
+		}
+
+		if len(form) == 0 {
+			return request, false, nil
+		}
+
+		body = []byte(form.Encode())
+		mediaType = fiber.MIMEApplicationForm
+	default:
+		return request, false, nil
+	}
+
+	request.Header.Set(fiber.HeaderContentType, mediaType)
+	request.Body = io.NopCloser(bytes.NewReader(body))
+	request.ContentLength = int64(len(body))
+
+	return request, true, nil
+}
+
+// validationMessage names the parameter or the field of the body that is
+// wrong, the errors of the validation are long.
+func validationMessage(err error) string {
+	var requestErr *openapi3filter.RequestError
+	if !errors.As(err, &requestErr) {
+		return err.Error()
+	}
+
+	reason := requestErr.Reason
+
+	var schemaErr *openapi3.SchemaError
+	if errors.As(requestErr.Err, &schemaErr) {
+		reason = schemaErr.Reason
+	} else if requestErr.Err != nil {
+		reason = requestErr.Err.Error()
+	}
+
+	switch {
+	case requestErr.Parameter != nil:
+		return fmt.Sprintf("%s: %s", requestErr.Parameter.Name, reason)
+	case schemaErr != nil && len(schemaErr.JSONPointer()) > 0:
+		return fmt.Sprintf("%s: %s", strings.Join(schemaErr.JSONPointer(), "."), reason)
+	}
+
+	return reason
+}
@@ -0,0 +1,104 @@
+package server_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"dss-main/server"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+)
+
+const testID = "64b000000000000000000001"
+
+func Test_openAPIValidate(t *testing.T) {
+	spec, err := server.LoadOpenAPI()
+	require.NoError(t, err)
+
+	app := fiber.New(fiber.Config{UnescapePath: true, ErrorHandler: server.ErrorHandler})
+	app.Get("/api/openapi.json", spec.Spec)
+
+	v1 := app.Group("/api/v1")
+	v1.Use(spec.Validate)
+
+	ok := func(ctx *fiber.Ctx) error {
+		return ctx.SendString(ctx.Route().Path)
+	}
+
+	v1.Get("/dir/*", ok)
+	v1.Get("/status/:id", ok)
+	v1.Post("/mkdir", ok)
+	v1.Post("/tags/bulk", ok)
+	v1.Post("/tags/:id", ok)
+	v1.Post("/batch", ok)
+	v1.Get("/undocumented", ok)
+
+	tests := []struct {
+		method      string
+		target      string
+		contentType string
+		body        string
+		status      int
+		message     string
+	}{
+		{method: http.MethodGet, target: "/api/openapi.json", status: http.StatusOK},
+		{method: http.MethodGet, target: "/api/v1/dir", status: http.StatusOK},
+		{method: http.MethodGet, target: "/api/v1/dir/a/b?limit=10&sort=size", status: http.StatusOK},
+		{method: http.MethodGet, target: "/api/v1/dir/a?limit=0", status: http.StatusBadRequest, message: "limit"},
+		{method: http.MethodGet, target: "/api/v1/dir/a?sort=color", status: http.StatusBadRequest, message: "sort"},
+		{method: http.MethodGet, target: "/api/v1/dir/a?processing=maybe", status: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/api/v1/status/" + testID, status: http.StatusOK},
+		{method: http.MethodGet, target: "/api/v1/status/42", status: http.StatusBadRequest, message: "id"},
+		{method: http.MethodPost, target: "/api/v1/mkdir?name=a&parents=true", status: http.StatusOK},
+		{
+			method: http.MethodPost, target: "/api/v1/mkdir", contentType: fiber.MIMEApplicationForm,
+			body: "name=a&conflict=keep", status: http.StatusBadRequest, message: "conflict",
+		},
+		{
+			method: http.MethodPost, target: "/api/v1/tags/bulk", contentType: fiber.MIMEApplicationForm,
+			body: "path=/a&op=add", status: http.StatusOK,
+		},
+		{
+			method: http.MethodPost, target: "/api/v1/tags/bulk", contentType: fiber.MIMEApplicationForm,
+			body: "path=&op=add", status: http.StatusBadRequest, message: "path",
+		},
+		{method: http.MethodPost, target: "/api/v1/tags/" + testID + "?tags=a,b", status: http.StatusOK},
+		{
+			method: http.MethodPost, target: "/api/v1/batch", contentType: fiber.MIMEApplicationJSON,
+			body: `{"operations":[{"op":"delete","id":"` + testID + `"}]}`, status: http.StatusOK,
+		},
+		{
+			method: http.MethodPost, target: "/api/v1/batch", contentType: fiber.MIMEApplicationJSON,
+			body: `{"operations":[{"op":"explode"}]}`, status: http.StatusBadRequest, message: "op",
+		},
+		{method: http.MethodGet, target: "/api/v1/undocumented?limit=0", status: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+		if test.contentType != "" {
+			request.Header.Set(fiber.HeaderContentType, test.contentType)
+		}
+
+		response, err := app.Test(request)
+		require.NoError(t, err)
+
+		body, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+
+		require.Equalf(t, test.status, response.StatusCode, "%s %s: %s", test.method, test.target, body)
+		if test.status != http.StatusBadRequest {
+			continue
+		}
+
+		var errResponse server.ErrorResponse
+		require.NoError(t, json.Unmarshal(body, &errResponse))
+		require.Equal(t, server.CodeInvalidRequest, errResponse.Code)
+		require.Containsf(t, errResponse.Message, test.message, "%s %s", test.method, test.target)
+	}
+}
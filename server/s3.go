@@ -0,0 +1,959 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dss-main/server/sigv4"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/yakiroren/dss-common/models"
+)
+
+const (
+	s3MaxKeys       = 1000
+	s3TimeFormat    = "2006-01-02T15:04:05.000Z"
+	s3Namespace     = "http://s3.amazonaws.com/doc/2006-03-01/"
+	s3MaxDeleteKeys = 1000
+	// s3MaxXMLBody bounds the xml documents of requests, like the keys of a
+	// DeleteObjects or the parts of a multipart upload.
+	s3MaxXMLBody = 4 << 20
+)
+
+// S3Error is the error document of the S3 api.
+type S3Error struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource,omitempty"`
+	status   int
+}
+
+func (e *S3Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func newS3Error(status int, code string, message string) *S3Error {
+	return &S3Error{Code: code, Message: message, status: status}
+}
+
+// s3Error translates the errors of the integrity layer into S3 errors.
+func s3Error(err error) *S3Error {
+	var s3Err *S3Error
+	if errors.As(err, &s3Err) {
+		return s3Err
+	}
+
+	switch status := davStatus(err); status {
+	case http.StatusNotFound:
+		return newS3Error(status, "NoSuchKey", err.Error())
+	case http.StatusConflict:
+		return newS3Error(status, "OperationAborted", err.Error())
+	case http.StatusBadRequest:
+		return newS3Error(status, "InvalidArgument", err.Error())
+	}
+
+	log.Error(err)
+
+	return newS3Error(http.StatusInternalServerError, "InternalError", "we encountered an internal error")
+}
+
+type s3Object struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type s3Prefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type s3ListResult struct {
+	XMLName               xml.Name   `xml:"ListBucketResult"`
+	Namespace             string     `xml:"xmlns,attr"`
+	Name                  string     `xml:"Name"`
+	Prefix                string     `xml:"Prefix"`
+	Delimiter             string     `xml:"Delimiter,omitempty"`
+	MaxKeys               int        `xml:"MaxKeys"`
+	KeyCount              int        `xml:"KeyCount"`
+	IsTruncated           bool       `xml:"IsTruncated"`
+	EncodingType          string     `xml:"EncodingType,omitempty"`
+	StartAfter            string     `xml:"StartAfter,omitempty"`
+	ContinuationToken     string     `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string     `xml:"NextContinuationToken,omitempty"`
+	Contents              []s3Object `xml:"Contents"`
+	CommonPrefixes        []s3Prefix `xml:"CommonPrefixes"`
+}
+
+type s3Bucket struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type s3BucketList struct {
+	XMLName   xml.Name   `xml:"ListAllMyBucketsResult"`
+	Namespace string     `xml:"xmlns,attr"`
+	OwnerID   string     `xml:"Owner>ID"`
+	Buckets   []s3Bucket `xml:"Buckets>Bucket"`
+}
+
+type s3Location struct {
+	XMLName   xml.Name `xml:"LocationConstraint"`
+	Namespace string   `xml:"xmlns,attr"`
+	Region    string   `xml:",chardata"`
+}
+
+type s3CopyResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	LastModified string   `xml:"LastModified"`
+	ETag         string   `xml:"ETag"`
+}
+
+type s3DeleteRequest struct {
+	Quiet   bool `xml:"Quiet"`
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+}
+
+type s3Deleted struct {
+	Key string `xml:"Key"`
+}
+
+type s3DeleteError struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type s3DeleteResult struct {
+	XMLName   xml.Name        `xml:"DeleteResult"`
+	Namespace string          `xml:"xmlns,attr"`
+	Deleted   []s3Deleted     `xml:"Deleted"`
+	Errors    []s3DeleteError `xml:"Error"`
+}
+
+// s3Gateway maps buckets to top level directories and keys to the paths
+// under them. Only path style requests are supported.
+type s3Gateway struct {
+	server    *Server
+	verifier  *sigv4.Verifier
+	multipart *multipartRegistry
+}
+
+// S3 serves the namespace through an S3 compatible api, requests are
+// authenticated with signature version 4 against credentials, a map of
+// access keys to secret keys.
+func (s *Server) S3(region string, credentials map[string]string) http.Handler {
+	return &s3Gateway{
+		server:    s,
+		verifier:  &sigv4.Verifier{Region: region, Credentials: credentials},
+		multipart: newMultipartRegistry(),
+	}
+}
+
+func (g *s3Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	signature, err := g.verifier.Verify(r)
+	if err != nil {
+		code := "AccessDenied"
+
+		switch {
+		case errors.Is(err, sigv4.ErrSignature):
+			code = "SignatureDoesNotMatch"
+		case errors.Is(err, sigv4.ErrUnknownKey):
+			code = "InvalidAccessKeyId"
+		case errors.Is(err, sigv4.ErrExpired):
+			code = "RequestTimeTooSkewed"
+		}
+
+		g.fail(w, r, newS3Error(http.StatusForbidden, code, err.Error()))
+
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	if err = g.route(w, r, signature, bucket, key); err != nil {
+		g.fail(w, r, s3Error(err))
+	}
+}
+
+func (g *s3Gateway) fail(w http.ResponseWriter, r *http.Request, err *S3Error) {
+	err.Resource = r.URL.Path
+
+	if r.Method == http.MethodHead {
+		w.WriteHeader(err.status)
+		return
+	}
+
+	writeXML(w, err.status, err)
+}
+
+func writeXML(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		log.Error(err)
+		return
+	}
+
+	if err := xml.NewEncoder(w).Encode(body); err != nil {
+		log.Error(err)
+	}
+}
+
+func (g *s3Gateway) route(w http.ResponseWriter, r *http.Request, signature *sigv4.Signature, bucket string,
+	key string,
+) error {
+	query := r.URL.Query()
+	ctx := r.Context()
+
+	if bucket == "" {
+		if r.Method != http.MethodGet {
+			return newS3Error(http.StatusMethodNotAllowed, "MethodNotAllowed", "only buckets can be listed")
+		}
+
+		return g.listBuckets(ctx, w)
+	}
+
+	if key == "" {
+		switch {
+		case r.Method == http.MethodGet && query.Has("location"):
+			writeXML(w, http.StatusOK, s3Location{Namespace: s3Namespace, Region: g.verifier.Region})
+			return nil
+		case r.Method == http.MethodGet:
+			return g.listObjects(ctx, w, bucket, query)
+		case r.Method == http.MethodHead:
+			_, err := g.bucketDir(ctx, bucket)
+			return err
+		case r.Method == http.MethodPut:
+			return g.createBucket(ctx, bucket)
+		case r.Method == http.MethodDelete:
+			return g.deleteBucket(ctx, w, bucket)
+		case r.Method == http.MethodPost && query.Has("delete"):
+			return g.deleteObjects(ctx, w, r, signature, bucket)
+		}
+
+		return newS3Error(http.StatusMethodNotAllowed, "MethodNotAllowed", "the method is not allowed on a bucket")
+	}
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		return g.createMultipartUpload(ctx, w, bucket, key)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		return g.uploadPart(w, r, signature, bucket, key)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		return g.completeMultipartUpload(ctx, w, r, signature, bucket, key)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		return g.abortMultipartUpload(w, query.Get("uploadId"), bucket, key)
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		return g.getObject(w, r, bucket, key)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		return g.copyObject(ctx, w, r, bucket, key)
+	case r.Method == http.MethodPut:
+		return g.putObject(w, r, signature, bucket, key)
+	case r.Method == http.MethodDelete:
+		return g.deleteObject(ctx, w, bucket, key)
+	}
+
+	return newS3Error(http.StatusMethodNotAllowed, "MethodNotAllowed", "the method is not allowed on an object")
+}
+
+// bucketDir returns the directory of a bucket.
+func (g *s3Gateway) bucketDir(ctx context.Context, bucket string) (string, error) {
+	dir := "/" + cleanPath(bucket)
+	if !validName(cleanPath(bucket)) {
+		return "", newS3Error(http.StatusBadRequest, "InvalidBucketName", "the bucket name is not valid")
+	}
+
+	metadata, exists := g.server.datastore.GetMetadataByPath(ctx, dir)
+	if !exists || !metadata.IsDirectory {
+		return "", newS3Error(http.StatusNotFound, "NoSuchBucket", "the bucket does not exist")
+	}
+
+	return dir, nil
+}
+
+// objectPath maps a key to the path of its file, a trailing slash marks a
+// directory.
+func (g *s3Gateway) objectPath(ctx context.Context, bucket string, key string) (string, error) {
+	dir, err := g.bucketDir(ctx, bucket)
+	if err != nil {
+		return "", err
+	}
+
+	full := cleanPath(dir + "/" + key)
+	if !validatePath(full) {
+		return "", newS3Error(http.StatusBadRequest, "InvalidArgument", "the key is not a valid path")
+	}
+
+	return full, nil
+}
+
+func objectKey(bucketDir string, metadata models.FileMetadata) string {
+	key := strings.TrimPrefix(filepath.Join(metadata.Path, metadata.FileName), bucketDir+"/")
+	if metadata.IsDirectory {
+		key += "/"
+	}
+
+	return key
+}
+
+// objectETag identifies the content of a file, it is not an md5 so clients
+// don't check it against the content.
+func objectETag(metadata models.FileMetadata) string {
+	return fmt.Sprintf(`"%s-%d"`, metadata.Id.Hex(), metadata.TotalFragments)
+}
+
+// readable rejects reading a file whose fragments are still being uploaded,
+// S3 clients retry a 503 on their own.
+func readable(w http.ResponseWriter, metadata *models.FileMetadata) error {
+	if !isProcessing(metadata) {
+		return nil
+	}
+
+	w.Header().Set("Retry-After", "1")
+
+	return newS3Error(http.StatusServiceUnavailable, "SlowDown", "the object is still being uploaded")
+}
+
+func (g *s3Gateway) listBuckets(ctx context.Context, w http.ResponseWriter) error {
+	files, err := g.server.datastore.ListFiles(ctx, "/")
+	if err != nil {
+		return err
+	}
+
+	result := s3BucketList{Namespace: s3Namespace, OwnerID: "dss", Buckets: []s3Bucket{}}
+
+	for _, file := range files {
+		if isRoot(file) || !file.IsDirectory {
+			continue
+		}
+
+		result.Buckets = append(result.Buckets, s3Bucket{
+			Name:         file.FileName,
+			CreationDate: time.Unix(file.CreationTime, 0).UTC().Format(s3TimeFormat),
+		})
+	}
+
+	writeXML(w, http.StatusOK, result)
+
+	return nil
+}
+
+func (g *s3Gateway) createBucket(ctx context.Context, bucket string) error {
+	name := cleanPath(bucket)
+	if !validName(name) {
+		return newS3Error(http.StatusBadRequest, "InvalidBucketName", "the bucket name is not valid")
+	}
+
+	_, _, err := g.server.makeDir(ctx, "/", name, ConflictFail)
+	if davStatus(err) == http.StatusConflict {
+		return newS3Error(http.StatusConflict, "BucketAlreadyOwnedByYou", "the bucket already exists")
+	}
+
+	return err
+}
+
+func (g *s3Gateway) deleteBucket(ctx context.Context, w http.ResponseWriter, bucket string) error {
+	dir, err := g.bucketDir(ctx, bucket)
+	if err != nil {
+		return err
+	}
+
+	metadata, _ := g.server.datastore.GetMetadataByPath(ctx, dir)
+
+	if err = g.server.remove(ctx, metadata, false); davStatus(err) == http.StatusConflict {
+		return newS3Error(http.StatusConflict, "BucketNotEmpty", "the bucket is not empty")
+	} else if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+// listObjects implements ListObjectsV2. With the / delimiter only the
+// directory of the prefix is listed, otherwise the bucket is paged through
+// in key order.
+func (g *s3Gateway) listObjects(ctx context.Context, w http.ResponseWriter, bucket string, query url.Values) error {
+	dir, err := g.bucketDir(ctx, bucket)
+	if err != nil {
+		return err
+	}
+
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+
+	maxKeys := s3MaxKeys
+	if value := query.Get("max-keys"); value != "" {
+		maxKeys, err = strconv.Atoi(value)
+		if err != nil || maxKeys < 0 {
+			return newS3Error(http.StatusBadRequest, "InvalidArgument", "max-keys must be a positive number")
+		}
+
+		if maxKeys > s3MaxKeys {
+			maxKeys = s3MaxKeys
+		}
+	}
+
+	marker := query.Get("start-after")
+	if token := query.Get("continuation-token"); token != "" {
+		decoded, decodeErr := base64.RawURLEncoding.DecodeString(token)
+		if decodeErr != nil {
+			return newS3Error(http.StatusBadRequest, "InvalidArgument", "the continuation token is not valid")
+		}
+
+		marker = string(decoded)
+	}
+
+	entries, err := g.listing(ctx, dir, prefix, delimiter, marker, maxKeys)
+	if err != nil {
+		return err
+	}
+
+	result := s3ListResult{
+		Namespace:         s3Namespace,
+		Name:              bucket,
+		Prefix:            prefix,
+		Delimiter:         delimiter,
+		MaxKeys:           maxKeys,
+		StartAfter:        query.Get("start-after"),
+		ContinuationToken: query.Get("continuation-token"),
+	}
+
+	for _, entry := range entries {
+		if entry.key <= marker {
+			continue
+		}
+
+		if result.KeyCount == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+
+		if entry.prefix {
+			result.CommonPrefixes = append(result.CommonPrefixes, s3Prefix{Prefix: entry.key})
+		} else {
+			result.Contents = append(result.Contents, s3Object{
+				Key:          entry.key,
+				LastModified: time.Unix(entry.file.CreationTime, 0).UTC().Format(s3TimeFormat),
+				ETag:         objectETag(entry.file),
+				Size:         entry.file.FileSize,
+				StorageClass: "STANDARD",
+			})
+		}
+
+		result.KeyCount++
+		marker = entry.key
+	}
+
+	if result.IsTruncated {
+		result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(marker))
+	}
+
+	if query.Get("encoding-type") == "url" {
+		result.EncodingType = "url"
+		result.Prefix = sigv4.Escape(result.Prefix, false)
+
+		for i := range result.Contents {
+			result.Contents[i].Key = sigv4.Escape(result.Contents[i].Key, false)
+		}
+
+		for i := range result.CommonPrefixes {
+			result.CommonPrefixes[i].Prefix = sigv4.Escape(result.CommonPrefixes[i].Prefix, false)
+		}
+	}
+
+	writeXML(w, http.StatusOK, result)
+
+	return nil
+}
+
+// listing returns the sorted entries under prefix that may be listed after
+// marker, at least maxKeys + 1 of them when there are that many. With the /
+// delimiter only the directory of the prefix is read, otherwise the bucket
+// is paged through in key order.
+func (g *s3Gateway) listing(ctx context.Context, dir string, prefix string, delimiter string, marker string,
+	maxKeys int,
+) ([]listEntry, error) {
+	if delimiter == "/" {
+		listed := dir
+		if i := strings.LastIndex(prefix, "/"); i >= 0 {
+			listed = cleanPath(dir + "/" + prefix[:i])
+		}
+
+		if !validatePath(listed) {
+			return nil, nil
+		}
+
+		files, err := g.server.datastore.ListFiles(ctx, listed)
+		if err != nil {
+			return nil, err
+		}
+
+		return listEntries(dir, files, prefix, delimiter), nil
+	}
+
+	var entries []listEntry
+
+	from := ""
+	if marker != "" {
+		from = keyAfter(marker)
+	}
+
+	for len(entries) <= maxKeys {
+		limit := maxKeys + 1 - len(entries)
+
+		files, err := g.server.catalog.Objects(ctx, dir, prefix, from, int64(limit))
+		if err != nil {
+			return nil, err
+		}
+
+		skip := ""
+		for _, entry := range listEntries(dir, files, prefix, delimiter) {
+			if entry.prefix {
+				skip = prefixEnd(entry.key)
+			}
+
+			if entry.key > marker && (len(entries) == 0 || entries[len(entries)-1].key != entry.key) {
+				entries = append(entries, entry)
+			}
+		}
+
+		if len(files) < limit {
+			break
+		}
+
+		// the rest of a common prefix would only repeat it.
+		from = keyAfter(objectKey(dir, files[len(files)-1]))
+		if skip > from {
+			from = skip
+		}
+	}
+
+	return entries, nil
+}
+
+// keyAfter is the smallest key that sorts after key.
+func keyAfter(key string) string {
+	return key + "\x00"
+}
+
+// prefixEnd is the smallest key that sorts after every key starting with
+// prefix, or prefix itself when there is none.
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+
+	return prefix
+}
+
+type listEntry struct {
+	key    string
+	prefix bool
+	file   models.FileMetadata
+}
+
+// listEntries turns files into the sorted keys and common prefixes under
+// prefix. Directories only show up through the keys of their files.
+func listEntries(dir string, files []models.FileMetadata, prefix string, delimiter string) []listEntry {
+	seen := map[string]bool{}
+	entries := make([]listEntry, 0, len(files))
+
+	for _, file := range files {
+		if isRoot(file) {
+			continue
+		}
+
+		key := objectKey(dir, file)
+		if key == "/" || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		rest := strings.TrimPrefix(key, prefix)
+
+		if delimiter != "" {
+			if i := strings.Index(rest, delimiter); i >= 0 {
+				common := prefix + rest[:i+len(delimiter)]
+				if !seen[common] {
+					seen[common] = true
+					entries = append(entries, listEntry{key: common, prefix: true})
+				}
+
+				continue
+			}
+		}
+
+		if file.IsDirectory {
+			continue
+		}
+
+		entries = append(entries, listEntry{key: key, file: file})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	return entries
+}
+
+func (g *s3Gateway) getObject(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	ctx := r.Context()
+
+	full, err := g.objectPath(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	metadata, exists := g.server.datastore.GetMetadataByPath(ctx, full)
+	if !exists || metadata.IsDirectory {
+		return newS3Error(http.StatusNotFound, "NoSuchKey", "the key does not exist")
+	}
+
+	if r.Method == http.MethodGet {
+		if err = readable(w, metadata); err != nil {
+			return err
+		}
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(metadata.FileName))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", objectETag(*metadata))
+
+	// the file seeks to the fragment holding the start of a range.
+	file := &davFile{ctx: ctx, server: g.server, metadata: metadata}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil {
+			log.Error(closeErr)
+		}
+	}()
+
+	http.ServeContent(w, r, metadata.FileName, time.Unix(metadata.CreationTime, 0), file)
+
+	return nil
+}
+
+// payload returns the body of a request and its length, -1 when unknown.
+// A signed payload hash is checked once the body was read, by verify.
+func payload(r *http.Request, signature *sigv4.Signature) (io.Reader, int64, *payloadHash, error) {
+	if strings.HasPrefix(signature.PayloadHash, sigv4.StreamingPrefix) {
+		size := int64(unknownSize)
+
+		if decoded := r.Header.Get("X-Amz-Decoded-Content-Length"); decoded != "" {
+			parsed, err := strconv.ParseInt(decoded, 10, 64)
+			if err != nil || parsed < 0 {
+				return nil, 0, nil, newS3Error(http.StatusBadRequest, "InvalidArgument",
+					"x-amz-decoded-content-length is not valid")
+			}
+
+			size = parsed
+		}
+
+		return sigv4.NewChunkedReader(r.Body), size, nil, nil
+	}
+
+	size := r.ContentLength
+	if size < 0 {
+		size = unknownSize
+	}
+
+	if signature.PayloadHash == sigv4.UnsignedPayload {
+		return r.Body, size, nil, nil
+	}
+
+	expected, err := hex.DecodeString(signature.PayloadHash)
+	if err != nil || len(expected) != sha256.Size {
+		return nil, 0, nil, newS3Error(http.StatusBadRequest, "InvalidArgument", "x-amz-content-sha256 is not valid")
+	}
+
+	hashed := &payloadHash{expected: expected, hash: sha256.New()}
+
+	return io.TeeReader(r.Body, hashed.hash), size, hashed, nil
+}
+
+type payloadHash struct {
+	expected []byte
+	hash     hash.Hash
+}
+
+func (p *payloadHash) verify() error {
+	if p == nil || string(p.hash.Sum(nil)) == string(p.expected) {
+		return nil
+	}
+
+	return newS3Error(http.StatusBadRequest, "XAmzContentSHA256Mismatch", sigv4.ErrPayloadMismatch.Error())
+}
+
+// xmlBody reads the xml document of a request, it is only returned once it
+// matched its signed payload hash.
+func xmlBody(r *http.Request, signature *sigv4.Signature) ([]byte, error) {
+	body, _, hashed, err := payload(r, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(body, s3MaxXMLBody+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) > s3MaxXMLBody {
+		return nil, newS3Error(http.StatusBadRequest, "MalformedXML", "the xml document is too large")
+	}
+
+	if err = hashed.verify(); err != nil {
+		return nil, err
+	}
+
+	return raw, nil
+}
+
+// stageBody writes a body to a temporary file and checks it against its
+// length and payload hash, so a body that was cut short or doesn't match its
+// signature never replaces an object. It returns the file rewound, along
+// with the length of the body.
+func stageBody(body io.Reader, size int64, hashed *payloadHash) (*os.File, int64, error) {
+	staged, err := os.CreateTemp("", "dss-s3-*")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	written, err := io.Copy(staged, body)
+	if err == nil && size != unknownSize && written != size {
+		err = newS3Error(http.StatusBadRequest, "IncompleteBody", "the body is shorter than its declared length")
+	}
+
+	if err == nil {
+		err = hashed.verify()
+	}
+
+	if err == nil {
+		_, err = staged.Seek(0, io.SeekStart)
+	}
+
+	if err != nil {
+		removeStaged(staged)
+		return nil, 0, err
+	}
+
+	return staged, written, nil
+}
+
+func removeStaged(staged *os.File) {
+	if err := staged.Close(); err != nil {
+		log.Error(err)
+	}
+
+	if err := os.Remove(staged.Name()); err != nil {
+		log.Error(err)
+	}
+}
+
+func (g *s3Gateway) putObject(w http.ResponseWriter, r *http.Request, signature *sigv4.Signature, bucket string,
+	key string,
+) error {
+	ctx := r.Context()
+
+	full, err := g.objectPath(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	// an empty key ending with a slash is how S3 clients create folders.
+	if strings.HasSuffix(key, "/") {
+		if err = g.server.ensureDir(ctx, full); err != nil {
+			return err
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		return nil
+	}
+
+	body, size, hashed, err := payload(r, signature)
+	if err != nil {
+		return err
+	}
+
+	staged, size, err := stageBody(body, size, hashed)
+	if err != nil {
+		return err
+	}
+
+	defer removeStaged(staged)
+
+	dir, name := filepath.Dir(full), filepath.Base(full)
+	if err = g.server.ensureDir(ctx, dir); err != nil {
+		return err
+	}
+
+	result, err := g.server.store(ctx, upload{
+		path:      dir,
+		name:      name,
+		size:      size,
+		policy:    ConflictOverwrite,
+		versioned: g.server.catalog.Versioning(ctx, dir),
+	}, staged)
+	if err != nil {
+		return err
+	}
+
+	metadata, _ := g.server.datastore.GetMetadataByID(ctx, result.ID)
+	if metadata != nil {
+		w.Header().Set("ETag", objectETag(*metadata))
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	return nil
+}
+
+func (g *s3Gateway) copyObject(ctx context.Context, w http.ResponseWriter, r *http.Request, bucket string,
+	key string,
+) error {
+	source, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		return newS3Error(http.StatusBadRequest, "InvalidArgument", "x-amz-copy-source is not valid")
+	}
+
+	source, _, _ = strings.Cut(source, "?")
+	sourceBucket, sourceKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+
+	sourcePath, err := g.objectPath(ctx, sourceBucket, sourceKey)
+	if err != nil {
+		return err
+	}
+
+	metadata, exists := g.server.datastore.GetMetadataByPath(ctx, sourcePath)
+	if !exists || metadata.IsDirectory {
+		return newS3Error(http.StatusNotFound, "NoSuchKey", "the source key does not exist")
+	}
+
+	if err = readable(w, metadata); err != nil {
+		return err
+	}
+
+	full, err := g.objectPath(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	copied := metadata
+
+	// copying an object onto itself only replaces its S3 metadata, which
+	// isn't stored.
+	if full != sourcePath {
+		dir := filepath.Dir(full)
+		if err = g.server.ensureDir(ctx, dir); err != nil {
+			return err
+		}
+
+		copied, err = g.server.copy(ctx, metadata, dir, filepath.Base(full), ConflictOverwrite)
+		if err != nil {
+			return err
+		}
+	}
+
+	writeXML(w, http.StatusOK, s3CopyResult{
+		LastModified: time.Unix(copied.CreationTime, 0).UTC().Format(s3TimeFormat),
+		ETag:         objectETag(*copied),
+	})
+
+	return nil
+}
+
+func (g *s3Gateway) deleteObject(ctx context.Context, w http.ResponseWriter, bucket string, key string) error {
+	if err := g.removeKey(ctx, bucket, key); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+// removeKey deletes the file of a key, a missing key is not an error. A
+// key ending with a slash removes its directory when it is empty.
+func (g *s3Gateway) removeKey(ctx context.Context, bucket string, key string) error {
+	full, err := g.objectPath(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	metadata, exists := g.server.datastore.GetMetadataByPath(ctx, full)
+	if !exists || metadata.IsDirectory != strings.HasSuffix(key, "/") {
+		return nil
+	}
+
+	return g.server.remove(ctx, metadata, false)
+}
+
+func (g *s3Gateway) deleteObjects(ctx context.Context, w http.ResponseWriter, r *http.Request,
+	signature *sigv4.Signature, bucket string,
+) error {
+	if _, err := g.bucketDir(ctx, bucket); err != nil {
+		return err
+	}
+
+	raw, err := xmlBody(r, signature)
+	if err != nil {
+		return err
+	}
+
+	var request s3DeleteRequest
+	if err = xml.Unmarshal(raw, &request); err != nil {
+		return newS3Error(http.StatusBadRequest, "MalformedXML", "the delete request is not valid xml")
+	}
+
+	if len(request.Objects) > s3MaxDeleteKeys {
+		return newS3Error(http.StatusBadRequest, "MalformedXML",
+			fmt.Sprintf("at most %d keys can be deleted at once", s3MaxDeleteKeys))
+	}
+
+	result := s3DeleteResult{Namespace: s3Namespace}
+
+	for _, object := range request.Objects {
+		if err := g.removeKey(ctx, bucket, object.Key); err != nil {
+			s3Err := s3Error(err)
+			result.Errors = append(result.Errors, s3DeleteError{Key: object.Key, Code: s3Err.Code, Message: s3Err.Message})
+
+			continue
+		}
+
+		if !request.Quiet {
+			result.Deleted = append(result.Deleted, s3Deleted{Key: object.Key})
+		}
+	}
+
+	writeXML(w, http.StatusOK, result)
+
+	return nil
+}
@@ -0,0 +1,398 @@
+package server
+
+import (
+	"context"
+	"crypto/md5" //nolint:gosec // part etags are md5 digests in the S3 api
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dss-main/server/sigv4"
+
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	s3MaxParts = 10000
+	// abandoned multipart uploads are dropped after multipartRetention.
+	multipartRetention = 24 * time.Hour
+)
+
+type s3InitiateResult struct {
+	XMLName   xml.Name `xml:"InitiateMultipartUploadResult"`
+	Namespace string   `xml:"xmlns,attr"`
+	Bucket    string   `xml:"Bucket"`
+	Key       string   `xml:"Key"`
+	UploadID  string   `xml:"UploadId"`
+}
+
+type s3CompleteRequest struct {
+	Parts []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type s3CompleteResult struct {
+	XMLName   xml.Name `xml:"CompleteMultipartUploadResult"`
+	Namespace string   `xml:"xmlns,attr"`
+	Location  string   `xml:"Location"`
+	Bucket    string   `xml:"Bucket"`
+	Key       string   `xml:"Key"`
+	ETag      string   `xml:"ETag"`
+}
+
+type multipartPart struct {
+	file string
+	size int64
+	etag string
+}
+
+// multipartUpload stages its parts on disk, the parts can arrive in any
+// order and be sent again. Completing it publishes the parts in order as a
+// single file.
+type multipartUpload struct {
+	bucket  string
+	key     string
+	dir     string
+	started time.Time
+	parts   map[int]multipartPart
+}
+
+// multipartRegistry keeps the multipart uploads of this instance in memory.
+// Uploads in flight are lost when the server restarts, clients have to start
+// them again, and the parts they staged are swept at the next start. So
+// instances on the same host need a TMPDIR of their own.
+type multipartRegistry struct {
+	mutex   sync.Mutex
+	uploads map[string]*multipartUpload
+}
+
+func newMultipartRegistry() *multipartRegistry {
+	sweepMultipart()
+
+	return &multipartRegistry{uploads: map[string]*multipartUpload{}}
+}
+
+// sweepMultipart removes the parts staged by the uploads of a previous run.
+func sweepMultipart() {
+	dirs, err := filepath.Glob(filepath.Join(os.TempDir(), "dss-multipart-*"))
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	for _, dir := range dirs {
+		if err = os.RemoveAll(dir); err != nil {
+			log.Error(err)
+		}
+	}
+
+	if len(dirs) > 0 {
+		log.Info("removed the parts of ", len(dirs), " abandoned multipart uploads")
+	}
+}
+
+func (r *multipartRegistry) start(bucket string, key string) (string, error) {
+	dir, err := os.MkdirTemp("", "dss-multipart-*")
+	if err != nil {
+		return "", err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.forgetAbandoned()
+
+	id := primitive.NewObjectID().Hex()
+	r.uploads[id] = &multipartUpload{
+		bucket:  bucket,
+		key:     key,
+		dir:     dir,
+		started: time.Now(),
+		parts:   map[int]multipartPart{},
+	}
+
+	return id, nil
+}
+
+// get returns a copy of an upload, safe to use while parts keep arriving.
+func (r *multipartRegistry) get(id string, bucket string, key string) (multipartUpload, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	upload, found := r.uploads[id]
+	if !found || upload.bucket != bucket || upload.key != key {
+		return multipartUpload{}, newS3Error(http.StatusNotFound, "NoSuchUpload", "the multipart upload does not exist")
+	}
+
+	snapshot := *upload
+	snapshot.parts = make(map[int]multipartPart, len(upload.parts))
+
+	for number, part := range upload.parts {
+		snapshot.parts[number] = part
+	}
+
+	return snapshot, nil
+}
+
+func (r *multipartRegistry) addPart(id string, number int, part multipartPart) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	upload, found := r.uploads[id]
+	if !found {
+		return newS3Error(http.StatusNotFound, "NoSuchUpload", "the multipart upload does not exist")
+	}
+
+	upload.parts[number] = part
+
+	return nil
+}
+
+// finish removes an upload from the registry, the caller owns its staged
+// parts from then on.
+func (r *multipartRegistry) finish(id string, bucket string, key string) (*multipartUpload, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	upload, found := r.uploads[id]
+	if !found || upload.bucket != bucket || upload.key != key {
+		return nil, newS3Error(http.StatusNotFound, "NoSuchUpload", "the multipart upload does not exist")
+	}
+
+	delete(r.uploads, id)
+
+	return upload, nil
+}
+
+func (r *multipartRegistry) forgetAbandoned() {
+	cutoff := time.Now().Add(-multipartRetention)
+
+	for id, upload := range r.uploads {
+		if upload.started.Before(cutoff) {
+			upload.discard()
+			delete(r.uploads, id)
+		}
+	}
+}
+
+func (u *multipartUpload) discard() {
+	if err := os.RemoveAll(u.dir); err != nil {
+		log.Error(err)
+	}
+}
+
+func (g *s3Gateway) createMultipartUpload(ctx context.Context, w http.ResponseWriter, bucket string, key string,
+) error {
+	if _, err := g.objectPath(ctx, bucket, key); err != nil {
+		return err
+	}
+
+	id, err := g.multipart.start(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	writeXML(w, http.StatusOK, s3InitiateResult{Namespace: s3Namespace, Bucket: bucket, Key: key, UploadID: id})
+
+	return nil
+}
+
+func (g *s3Gateway) uploadPart(w http.ResponseWriter, r *http.Request, signature *sigv4.Signature, bucket string,
+	key string,
+) error {
+	query := r.URL.Query()
+	id := query.Get("uploadId")
+
+	number, err := strconv.Atoi(query.Get("partNumber"))
+	if err != nil || number < 1 || number > s3MaxParts {
+		return newS3Error(http.StatusBadRequest, "InvalidArgument",
+			fmt.Sprintf("partNumber must be between 1 and %d", s3MaxParts))
+	}
+
+	pending, err := g.multipart.get(id, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	body, _, hashed, err := payload(r, signature)
+	if err != nil {
+		return err
+	}
+
+	// a part sent again replaces the previous attempt once it is complete.
+	staged, err := os.CreateTemp(pending.dir, fmt.Sprintf("part-%d-*", number))
+	if err != nil {
+		return err
+	}
+
+	digest := md5.New() //nolint:gosec // part etags are md5 digests in the S3 api
+
+	size, err := io.Copy(io.MultiWriter(staged, digest), body)
+	if closeErr := staged.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = hashed.verify()
+	}
+
+	if err != nil {
+		if removeErr := os.Remove(staged.Name()); removeErr != nil {
+			log.Error(removeErr)
+		}
+
+		return err
+	}
+
+	etag := `"` + hex.EncodeToString(digest.Sum(nil)) + `"`
+
+	if err = g.multipart.addPart(id, number, multipartPart{file: staged.Name(), size: size, etag: etag}); err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusOK)
+
+	return nil
+}
+
+func (g *s3Gateway) completeMultipartUpload(ctx context.Context, w http.ResponseWriter, r *http.Request,
+	signature *sigv4.Signature, bucket string, key string,
+) error {
+	raw, err := xmlBody(r, signature)
+	if err != nil {
+		return err
+	}
+
+	var request s3CompleteRequest
+	if err = xml.Unmarshal(raw, &request); err != nil || len(request.Parts) == 0 {
+		return newS3Error(http.StatusBadRequest, "MalformedXML", "the list of parts is not valid")
+	}
+
+	full, err := g.objectPath(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	id := r.URL.Query().Get("uploadId")
+
+	pending, err := g.multipart.get(id, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	parts := make([]multipartPart, 0, len(request.Parts))
+	digests := md5.New() //nolint:gosec // multipart etags are md5 digests in the S3 api
+
+	var size int64
+
+	for i, requested := range request.Parts {
+		part, found := pending.parts[requested.PartNumber]
+		if !found || strings.Trim(part.etag, `"`) != strings.Trim(requested.ETag, `"`) {
+			return newS3Error(http.StatusBadRequest, "InvalidPart", fmt.Sprintf("part %d was not uploaded",
+				requested.PartNumber))
+		}
+
+		if i > 0 && requested.PartNumber <= request.Parts[i-1].PartNumber {
+			return newS3Error(http.StatusBadRequest, "InvalidPartOrder", "the parts must be in ascending order")
+		}
+
+		raw, _ := hex.DecodeString(strings.Trim(part.etag, `"`))
+		digests.Write(raw)
+
+		parts = append(parts, part)
+		size += part.size
+	}
+
+	// the upload is kept until here so a client can fix its list of parts.
+	if _, err = g.multipart.finish(id, bucket, key); err != nil {
+		return err
+	}
+
+	defer pending.discard()
+
+	content, closeParts, err := openParts(parts)
+	if err != nil {
+		return err
+	}
+
+	defer closeParts()
+
+	dir := filepath.Dir(full)
+	if err = g.server.ensureDir(ctx, dir); err != nil {
+		return err
+	}
+
+	// the parts were checked against their payload hashes when they were
+	// uploaded, and store only replaces the object once all of it is stored.
+	_, err = g.server.store(ctx, upload{
+		path:      dir,
+		name:      filepath.Base(full),
+		size:      size,
+		policy:    ConflictOverwrite,
+		versioned: g.server.catalog.Versioning(ctx, dir),
+	}, content)
+	if err != nil {
+		return err
+	}
+
+	writeXML(w, http.StatusOK, s3CompleteResult{
+		Namespace: s3Namespace,
+		Location:  r.URL.Path,
+		Bucket:    bucket,
+		Key:       key,
+		ETag:      fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(digests.Sum(nil)), len(parts)),
+	})
+
+	return nil
+}
+
+// openParts concatenates staged parts, the returned func closes them.
+func openParts(parts []multipartPart) (io.Reader, func(), error) {
+	files := make([]*os.File, 0, len(parts))
+	readers := make([]io.Reader, 0, len(parts))
+
+	closeAll := func() {
+		for _, file := range files {
+			if err := file.Close(); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+
+	for _, part := range parts {
+		file, err := os.Open(part.file)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+
+		files = append(files, file)
+		readers = append(readers, file)
+	}
+
+	return io.MultiReader(readers...), closeAll, nil
+}
+
+func (g *s3Gateway) abortMultipartUpload(w http.ResponseWriter, id string, bucket string, key string) error {
+	pending, err := g.multipart.finish(id, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	pending.discard()
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
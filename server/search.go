@@ -0,0 +1,119 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"dss-main/catalog"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gofiber/fiber/v2"
+)
+
+func (s *Server) Search(ctx *fiber.Ctx) error {
+	query, err := searchQuery(ctx)
+	if err != nil {
+		return err
+	}
+
+	opts, err := listOptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	page, err := s.list(ctx.Context(), query, opts)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(newDirListing(page))
+}
+
+func searchQuery(ctx *fiber.Ctx) (catalog.Query, error) {
+	query := catalog.Query{
+		PathPrefix: cleanPath(ctx.Query("path")),
+		Kind:       catalog.Kind(ctx.Query("type")),
+		Text:       ctx.Query("q"),
+		NameGlob:   ctx.Query("glob"),
+		Extension:  ctx.Query("ext"),
+	}
+
+	for _, tag := range ctx.Context().QueryArgs().PeekMulti("tag") {
+		query.Tags = append(query.Tags, string(tag))
+	}
+
+	if query.PathPrefix != "" && !validatePath(query.PathPrefix) {
+		return query, errInvalidPath
+	}
+
+	if !query.Kind.Valid() {
+		return query, fiber.NewError(http.StatusBadRequest, "type must be file or dir")
+	}
+
+	if processing := ctx.Query("processing"); processing != "" {
+		value, err := strconv.ParseBool(processing)
+		if err != nil {
+			return query, fiber.NewError(http.StatusBadRequest, "processing must be a boolean")
+		}
+		query.Processing = &value
+	}
+
+	var err error
+
+	if query.MinSize, err = sizeParam(ctx, "min_size"); err != nil {
+		return query, err
+	}
+
+	if query.MaxSize, err = sizeParam(ctx, "max_size"); err != nil {
+		return query, err
+	}
+
+	if query.CreatedAfter, err = timeParam(ctx, "after"); err != nil {
+		return query, err
+	}
+
+	if query.CreatedBefore, err = timeParam(ctx, "before"); err != nil {
+		return query, err
+	}
+
+	return query, nil
+}
+
+// sizeParam parses sizes given either in bytes or humanized, like 10MB.
+func sizeParam(ctx *fiber.Ctx, key string) (*int64, error) {
+	value := ctx.Query(key)
+	if value == "" {
+		return nil, nil //nolint:nilnil // a missing parameter is not an error
+	}
+
+	size, err := humanize.ParseBytes(value)
+	if err != nil {
+		return nil, fiber.NewError(http.StatusBadRequest, key+" is not a valid size")
+	}
+
+	bytes := int64(size)
+
+	return &bytes, nil
+}
+
+// timeParam parses times given either as unix seconds or RFC 3339.
+func timeParam(ctx *fiber.Ctx, key string) (*int64, error) {
+	value := ctx.Query(key)
+	if value == "" {
+		return nil, nil //nolint:nilnil // a missing parameter is not an error
+	}
+
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return &unix, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fiber.NewError(http.StatusBadRequest, key+" must be a unix timestamp or RFC 3339 time")
+	}
+
+	unix := parsed.Unix()
+
+	return &unix, nil
+}
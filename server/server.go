@@ -2,16 +2,23 @@ package server
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"math"
 	"mime/multipart"
 	"net/http"
+	"path/filepath"
 	"time"
 
+	"dss-main/catalog"
 	"dss-main/config"
 	"dss-main/server/rabbit"
+	ds "dss-main/storage"
+	discord "dss-main/storage/Discord"
 
 	"github.com/dustin/go-humanize"
 	"github.com/gofiber/fiber/v2"
@@ -23,36 +30,230 @@ import (
 
 type Server struct {
 	datastore    db.DataStore
+	catalog      *catalog.Catalog
+	storage      ds.Client
 	fragmentSize int64
+	batchLimit   int
+	jobs         *jobRegistry
+	auth         *authenticator
+	importClient *http.Client
 	Publisher    rabbit.Config
+	// connect opens the queue fragments are published to.
+	connect func() (publisher, error)
 }
 
-func NewServer(conf *config.Config, datastore db.DataStore) (*Server, error) {
-	return &Server{
+// publisher queues the fragments of files for the consumers that store them.
+type publisher interface {
+	PushMessage(id string, fragmentNumber int, content []byte) error
+	NotifyConsumers()
+	Close()
+}
+
+func NewServer(conf *config.Config, datastore db.DataStore, catalog *catalog.Catalog) (*Server, error) {
+	auth, err := newAuthenticator(conf, catalog)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
 		Publisher:    conf.Publisher,
 		datastore:    datastore,
+		catalog:      catalog,
+		storage:      discord.Client{},
 		fragmentSize: conf.FragmentSize,
-	}, nil
+		batchLimit:   conf.BatchLimit,
+		jobs:         newJobRegistry(),
+		auth:         auth,
+		importClient: newImportClient(),
+	}
+
+	s.connect = s.connectRabbit
+
+	return s, nil
 }
 
+// publisherKey holds a publisher shared by the uploads of a request, like
+// the entries of an extracted archive.
+type publisherKey struct{}
+
+// openPublisher returns the publisher shared through ctx or connects a new
+// one, release only closes a publisher it connected.
+func (s *Server) openPublisher(ctx context.Context) (publisher, func(), error) {
+	if pub, shared := ctx.Value(publisherKey{}).(publisher); shared {
+		return pub, func() {}, nil
+	}
+
+	pub, err := s.connect()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pub, pub.Close, nil
+}
+
+func (s *Server) connectRabbit() (publisher, error) {
+	pub, err := rabbit.New(s.Publisher, log.New())
+	if err != nil {
+		return nil, upstreamError("could not reach the fragment queue", err)
+	}
+
+	return pub, nil
+}
+
+// UploadResult is where an uploaded file ended up, the name differs from the
+// uploaded one when it was taken.
+type UploadResult struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Error string `json:"error,omitempty"`
+}
+
+// Upload stores the files of a multipart form. A single file is answered
+// with its id, several files or files with a relative_path (folder uploads)
+// are answered with a list of UploadResult.
 func (s *Server) Upload(ctx *fiber.Ctx) error {
-	file, err := ctx.FormFile("file")
+	// the form is spooled as it arrives, only a known length can be checked
+	// against the body limit beforehand.
+	if ctx.Request().Header.ContentLength() < 0 {
+		return fiber.NewError(http.StatusLengthRequired, "the upload needs a Content-Length")
+	}
+
+	form, err := ctx.MultipartForm()
 	if err != nil {
-		return err
+		return fiber.NewError(http.StatusBadRequest, "the upload must be a multipart form")
 	}
 
-	targetPath := ctx.FormValue("path", "/")
+	files := form.File["file"]
+	if len(files) == 0 {
+		return fiber.NewError(http.StatusBadRequest, "file cant be empty")
+	}
+
+	relativePaths := form.Value["relative_path"]
+	if len(relativePaths) > 0 && len(relativePaths) != len(files) {
+		return fiber.NewError(http.StatusBadRequest, "every file needs a relative_path")
+	}
+
+	targetPath := cleanPath(ctx.FormValue("path", "/"))
 
 	valid := validatePath(targetPath)
 	if !valid {
-		return fiber.NewError(http.StatusBadRequest, "the provided path is not valid")
+		return errInvalidPath
+	}
+
+	tags, err := parseTags(ctx)
+	if err != nil {
+		return err
+	}
+
+	parents, err := formBool(ctx, "parents")
+	if err != nil {
+		return err
+	}
+
+	if parents {
+		if err = s.ensureDir(ctx.Context(), targetPath); err != nil {
+			return err
+		}
+	}
+
+	versioned, err := s.versioned(ctx, targetPath)
+	if err != nil {
+		return err
+	}
+
+	policy, err := conflictPolicy(ctx, ConflictRename)
+	if err != nil {
+		return err
+	}
+
+	extract, err := formBool(ctx, "extract")
+	if err != nil {
+		return err
 	}
 
+	modTime, err := formModTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	template := upload{path: targetPath, tags: tags, policy: policy, versioned: versioned, modTime: modTime}
+
+	if extract {
+		if len(files) > 1 {
+			return fiber.NewError(http.StatusBadRequest, "only a single archive can be extracted")
+		}
+
+		return s.extractUpload(ctx, files[0], template)
+	}
+
+	if len(files) == 1 && len(relativePaths) == 0 {
+		result, storeErr := s.storeFile(ctx.Context(), files[0], template)
+		if errors.Is(storeErr, errSkipped) {
+			return ctx.Status(http.StatusOK).SendString(result.ID)
+		} else if storeErr != nil {
+			return storeErr
+		}
+
+		return ctx.Status(http.StatusCreated).SendString(result.ID)
+	}
+
+	if err = s.checkParent(ctx.Context(), targetPath); err != nil {
+		return err
+	}
+
+	results := make([]UploadResult, 0, len(files))
+	status := http.StatusCreated
+
+	for i, file := range files {
+		u := template
+		u.name = file.Filename
+
+		if len(relativePaths) > 0 {
+			full, ok := entryPath(targetPath, relativePaths[i])
+			if !ok {
+				status = http.StatusMultiStatus
+				results = append(results, UploadResult{Name: file.Filename, Error: "relative_path cant be empty"})
+
+				continue
+			}
+
+			u.path, u.name = filepath.Dir(full), filepath.Base(full)
+		}
+
+		result, storeErr := s.storeInDir(ctx.Context(), file, u)
+		if storeErr != nil && !errors.Is(storeErr, errSkipped) {
+			status = http.StatusMultiStatus
+			result.Error = storeErr.Error()
+		}
+
+		results = append(results, result)
+	}
+
+	return ctx.Status(status).JSON(results)
+}
+
+// storeInDir creates the directories of a folder upload before storing the
+// file in them.
+func (s *Server) storeInDir(ctx context.Context, file *multipart.FileHeader, u upload) (UploadResult, error) {
+	if err := s.ensureDir(ctx, u.path); err != nil {
+		return UploadResult{Name: u.name, Path: u.path}, err
+	}
+
+	return s.storeFile(ctx, file, u)
+}
+
+func (s *Server) storeFile(ctx context.Context, file *multipart.FileHeader, u upload) (UploadResult, error) {
+	if u.name == "" {
+		u.name = file.Filename
+	}
+
+	u.size = file.Size
+
 	log.Info("got file with size ", humanize.IBytes(uint64(file.Size)))
 	src, err := file.Open()
 	if err != nil {
-		ctx.Status(http.StatusBadRequest)
-		return fmt.Errorf("cant open file")
+		return UploadResult{Name: u.name, Path: u.path}, fiber.NewError(http.StatusBadRequest, "cant open file")
 	}
 
 	defer func(src multipart.File) {
@@ -61,62 +262,302 @@ func (s *Server) Upload(ctx *fiber.Ctx) error {
 		}
 	}(src)
 
-	totalFragments := int(math.Ceil(float64(file.Size) / float64(s.fragmentSize)))
+	return s.store(ctx, u, src)
+}
+
+// StreamUpload stores the raw request body at the path of the route, unlike
+// Upload the body is fragmented while it is received and its length doesn't
+// have to be known upfront.
+func (s *Server) StreamUpload(ctx *fiber.Ctx) error {
+	fullPath := wildcardPath(ctx)
+	if fullPath == "/" {
+		return invalidPathError("the path must end with the name of the file")
+	}
+
+	targetPath, name := filepath.Dir(fullPath), filepath.Base(fullPath)
+
+	if !validatePath(targetPath) {
+		return errInvalidPath
+	}
 
-	filename := s.fixFilename(ctx.Context(), file.Filename, targetPath)
+	tags, err := parseTags(ctx)
+	if err != nil {
+		return err
+	}
 
-	fileID, err := s.datastore.WriteFile(ctx.Context(), models.FileMetadata{
-		Id:             primitive.NewObjectID(),
-		FileName:       filename,
-		FileSize:       file.Size,
-		CurrentSize:    0,
-		CreationTime:   time.Now().Unix(),
-		Tags:           []string{},
-		IsDirectory:    false,
-		Path:           targetPath,
-		Fragments:      []models.Fragment{},
-		IsHidden:       true,
-		TotalFragments: totalFragments,
-	})
+	parents, err := formBool(ctx, "parents")
 	if err != nil {
 		return err
 	}
 
-	done, err := s.fragment(totalFragments, src, fileID)
-	if !done {
+	if parents {
+		if err = s.ensureDir(ctx.Context(), targetPath); err != nil {
+			return err
+		}
+	}
+
+	versioned, err := s.versioned(ctx, targetPath)
+	if err != nil {
 		return err
 	}
 
-	_ = ctx.Status(http.StatusCreated).SendString(fileID)
+	policy, err := conflictPolicy(ctx, ConflictRename)
+	if err != nil {
+		return err
+	}
 
-	return nil
+	modTime, err := formModTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	// chunked and close delimited bodies report a negative length.
+	size := int64(ctx.Request().Header.ContentLength())
+	if size < 0 {
+		size = unknownSize
+	}
+
+	result, err := s.store(ctx.Context(), upload{
+		path:      targetPath,
+		name:      name,
+		size:      size,
+		tags:      tags,
+		policy:    policy,
+		versioned: versioned,
+		modTime:   modTime,
+	}, requestBody(ctx))
+	if errors.Is(err, errSkipped) {
+		return ctx.Status(http.StatusOK).SendString(result.ID)
+	} else if err != nil {
+		// the rest of the body may still be unread.
+		ctx.Context().SetConnectionClose()
+		return err
+	}
+
+	return ctx.Status(http.StatusCreated).SendString(result.ID)
+}
+
+// unknownSize marks an upload whose length is only known once its content
+// has been read. Until then its TotalFragments is unknownSize and its
+// FileSize is 0, both are set when the content ends.
+const unknownSize = -1
+
+// upload describes a file about to be stored.
+type upload struct {
+	path      string
+	name      string
+	size      int64
+	tags      []string
+	policy    ConflictPolicy
+	versioned bool
+	// modTime is the modification time in unix seconds, zero means now.
+	modTime int64
+}
+
+func (s *Server) totalFragments(size int64) int {
+	if size == unknownSize {
+		return unknownSize
+	}
+
+	return int(math.Ceil(float64(size) / float64(s.fragmentSize)))
+}
+
+// store writes the metadata of an upload and publishes its content as
+// fragments. When the skip policy leaves an existing file in place it is
+// returned along with errSkipped.
+func (s *Server) store(ctx context.Context, u upload, src io.Reader) (UploadResult, error) {
+	registered, err := s.register(ctx, u)
+	if err != nil {
+		return registered.UploadResult, err
+	}
+
+	err = s.publish(ctx, registered.ID, u.size, src)
+
+	return registered.UploadResult, s.complete(ctx, registered, err)
+}
+
+// registration is an upload whose metadata was written and whose content is
+// about to be published.
+type registration struct {
+	UploadResult
+	// created is the new file, nil when the upload is a new version of an
+	// existing one.
+	created *models.FileMetadata
+	// replaces is the name created takes over once it is complete, it is
+	// written under a staged name until then.
+	replaces string
+}
+
+// register writes the metadata of an upload, its content is expected to be
+// published right after and handed to complete.
+func (s *Server) register(ctx context.Context, u upload) (registration, error) {
+	totalFragments := s.totalFragments(u.size)
+
+	size := u.size
+	if size == unknownSize {
+		size = 0
+	}
+
+	var fileID string
+	var err error
+
+	filename := sanitizeFilename(u.name)
+	existing, exists := s.datastore.GetMetadataByPath(ctx, filepath.Join(u.path, filename))
+
+	registered := registration{}
+
+	if u.versioned && exists && !existing.IsDirectory {
+		fileID, err = s.newVersion(ctx, existing, size, totalFragments, u.tags)
+	} else {
+		metadata := &models.FileMetadata{
+			Id:             primitive.NewObjectID(),
+			FileName:       filename,
+			FileSize:       size,
+			CurrentSize:    0,
+			CreationTime:   time.Now().Unix(),
+			Tags:           u.tags,
+			IsDirectory:    false,
+			Path:           u.path,
+			Fragments:      []models.Fragment{},
+			IsHidden:       true,
+			TotalFragments: totalFragments,
+		}
+
+		fileID, registered.replaces, err = s.create(ctx, metadata, u.policy)
+		filename = metadata.FileName
+
+		if registered.replaces != "" {
+			filename = registered.replaces
+		}
+
+		if err == nil {
+			registered.created = metadata
+		}
+	}
+
+	if errors.Is(err, errSkipped) {
+		// the name may have been taken by a concurrent upload after the
+		// lookup above, so the file that was kept is read again.
+		existing, exists = s.datastore.GetMetadataByPath(ctx, filepath.Join(u.path, filename))
+		if !exists {
+			registered.UploadResult = UploadResult{Name: filename, Path: u.path}
+			return registered, conflictError(fmt.Sprintf("%s changed during the upload", filepath.Join(u.path, filename)))
+		}
+
+		registered.UploadResult = UploadResult{ID: existing.Id.Hex(), Name: existing.FileName, Path: u.path}
+		return registered, err
+	} else if err != nil {
+		registered.UploadResult = UploadResult{Name: filename, Path: u.path}
+		return registered, err
+	}
+
+	registered.UploadResult = UploadResult{ID: fileID, Name: filename, Path: u.path}
+
+	modTime := u.modTime
+	if modTime == 0 {
+		modTime = time.Now().Unix()
+	}
+
+	if err = s.datastore.UpdateField(ctx, fileID, catalog.FieldModTime, modTime); err != nil {
+		log.Error(err)
+		return registered, s.complete(ctx, registered, fiber.ErrInternalServerError)
+	}
+
+	return registered, nil
+}
+
+// complete finishes a registered upload once its content was published. A
+// new file takes over the name it overwrites, or is deleted when publishing
+// failed so the file it was meant to replace is left untouched. A failed new
+// version is marked as failed, its previous content stays archived.
+func (s *Server) complete(ctx context.Context, registered registration, err error) error {
+	if registered.created == nil {
+		if err != nil {
+			if markErr := s.catalog.SetUploadError(context.Background(), registered.ID, err.Error()); markErr != nil {
+				log.Error(markErr)
+			}
+		}
+
+		return err
+	}
+
+	if err != nil {
+		s.discard(registered.created)
+		return err
+	}
+
+	return s.replace(ctx, registered.created, registered.replaces)
 }
 
-func (s *Server) fragment(totalFragments int, src io.Reader, id string) (bool, error) {
-	logger := log.New()
+// publish fragments the content of a registered file, with an unknown size
+// src is read until EOF and the metadata is completed afterwards. The
+// checksum of the content is stored once all of it was published.
+func (s *Server) publish(ctx context.Context, id string, size int64, src io.Reader) error {
+	hash := sha256.New()
+	src = io.TeeReader(src, hash)
+
+	if size != unknownSize {
+		done, err := s.fragment(ctx, size, src, id)
+		if !done {
+			return err
+		}
+	} else {
+		totalFragments, written, err := s.streamFragments(ctx, src, id)
+		if err != nil {
+			return err
+		}
 
-	pub, err := rabbit.New(s.Publisher, logger)
+		if err = s.datastore.UpdateField(ctx, id, catalog.FieldSize, written); err != nil {
+			log.Error(err)
+			return fiber.ErrInternalServerError
+		}
+
+		if err = s.datastore.UpdateField(ctx, id, catalog.FieldTotalFragments, totalFragments); err != nil {
+			log.Error(err)
+			return fiber.ErrInternalServerError
+		}
+	}
+
+	if err := s.datastore.UpdateField(ctx, id, catalog.FieldChecksum, hex.EncodeToString(hash.Sum(nil))); err != nil {
+		log.Error(err)
+		return fiber.ErrInternalServerError
+	}
+
+	return nil
+}
+
+// fragment publishes exactly size bytes of src, a body that ends early or
+// runs past its size fails with errSizeMismatch.
+func (s *Server) fragment(ctx context.Context, size int64, src io.Reader, id string) (bool, error) {
+	pub, release, err := s.openPublisher(ctx)
 	if err != nil {
-		return false, fmt.Errorf("failed to create rabbit publisher: %w", err)
+		return false, err
 	}
 
+	defer release()
+
+	totalFragments := s.totalFragments(size)
 	content := &bytes.Buffer{}
 	log.Info("Total fragments ", totalFragments)
 
 	go pub.NotifyConsumers()
 
+	var read int64
+
 	for i := 1; i <= totalFragments; i++ {
-		_, err = io.CopyN(content, src, s.fragmentSize)
-		if errors.Is(err, io.EOF) {
-			log.Debug("got EOF")
-		} else if err != nil {
-			log.Error(err)
-			return false, fiber.ErrInternalServerError
+		n, copyErr := io.CopyN(content, src, s.fragmentSize)
+		read += n
+
+		if errors.Is(copyErr, io.EOF) {
+			if read != size {
+				return false, errSizeMismatch
+			}
+		} else if copyErr != nil {
+			return false, readError(copyErr)
 		}
 
 		if err = pub.PushMessage(id, i, content.Bytes()); err != nil {
-			log.Error(err)
-			return false, fiber.ErrInternalServerError
+			return false, upstreamError("could not queue a fragment", err)
 		}
 
 		log.Debug("pushed fragment number ", i)
@@ -124,7 +565,72 @@ func (s *Server) fragment(totalFragments int, src io.Reader, id string) (bool, e
 		content.Reset()
 	}
 
-	pub.Close()
+	if read != size {
+		return false, errSizeMismatch
+	}
+
+	// anything past the size would be dropped silently.
+	extra, err := io.CopyN(io.Discard, src, 1)
+	if extra > 0 {
+		return false, errSizeMismatch
+	} else if err != nil && !errors.Is(err, io.EOF) {
+		return false, readError(err)
+	}
 
 	return true, nil
 }
+
+// readError passes the errors of the api through, other failures to read a
+// body are logged.
+func readError(err error) error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	log.Error(err)
+
+	return fiber.ErrInternalServerError
+}
+
+// streamFragments publishes src as fragments until it runs out, it returns
+// the number of fragments and bytes that were published.
+func (s *Server) streamFragments(ctx context.Context, src io.Reader, id string) (int, int64, error) {
+	pub, release, err := s.openPublisher(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer release()
+
+	go pub.NotifyConsumers()
+
+	content := &bytes.Buffer{}
+	fragments := 0
+	var written int64
+
+	for {
+		n, copyErr := io.CopyN(content, src, s.fragmentSize)
+		if copyErr != nil && !errors.Is(copyErr, io.EOF) {
+			return 0, 0, readError(copyErr)
+		}
+
+		if n > 0 {
+			fragments++
+			written += n
+
+			if err = pub.PushMessage(id, fragments, content.Bytes()); err != nil {
+				return 0, 0, upstreamError("could not queue a fragment", err)
+			}
+
+			log.Debug("pushed fragment number ", fragments)
+
+			content.Reset()
+		}
+
+		if copyErr != nil {
+			log.Info("Total fragments ", fragments)
+			return fragments, written, nil
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package server_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"dss-main/server"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memoryPublisher keeps the fragments it was given.
+type memoryPublisher struct {
+	fragments []string
+}
+
+func (p *memoryPublisher) PushMessage(_ string, _ int, content []byte) error {
+	p.fragments = append(p.fragments, string(content))
+	return nil
+}
+
+func (p *memoryPublisher) NotifyConsumers() {}
+
+func (p *memoryPublisher) Close() {}
+
+func Test_fragment(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int64
+		body      string
+		fragments []string
+		mismatch  bool
+	}{
+		{name: "exact", size: 10, body: "abcdefghij", fragments: []string{"abcd", "efgh", "ij"}},
+		{name: "empty", size: 0, body: ""},
+		{name: "short", size: 10, body: "abcdef", mismatch: true},
+		{name: "short by a fragment", size: 10, body: "abcdefgh", mismatch: true},
+		{name: "long", size: 8, body: "abcdefghij", mismatch: true},
+	}
+
+	for _, test := range tests {
+		srv := newTestServer(t)
+		pub := &memoryPublisher{}
+		server.SetPublisher(srv, pub)
+
+		err := server.Fragment(srv, test.size, strings.NewReader(test.body), "id")
+		if !test.mismatch {
+			require.NoError(t, err, test.name)
+			require.Equal(t, test.fragments, pub.fragments, test.name)
+			continue
+		}
+
+		var apiErr *server.Error
+		require.True(t, errors.As(err, &apiErr), test.name)
+		require.Equal(t, server.CodeInvalidRequest, apiErr.Code, test.name)
+	}
+}
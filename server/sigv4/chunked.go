@@ -0,0 +1,131 @@
+package sigv4
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxChunkHeader bounds the size line of a chunk and its extensions.
+const maxChunkHeader = 4096
+
+var ErrChunk = errors.New("the aws-chunked body is malformed")
+
+// chunkedReader decodes an aws-chunked body. The signatures of the chunks
+// aren't checked, the seed signature already authenticated the request.
+type chunkedReader struct {
+	reader    *bufio.Reader
+	remaining int64
+	done      bool
+}
+
+// NewChunkedReader returns the payload of an aws-chunked body.
+func NewChunkedReader(r io.Reader) io.Reader {
+	return &chunkedReader{reader: bufio.NewReader(r)}
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.done {
+		return 0, io.EOF
+	}
+
+	if c.remaining == 0 {
+		size, err := c.nextChunk()
+		if err != nil {
+			return 0, err
+		}
+
+		if size == 0 {
+			c.done = true
+			return 0, c.skipTrailers()
+		}
+
+		c.remaining = size
+	}
+
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+
+	n, err := c.reader.Read(p)
+	c.remaining -= int64(n)
+
+	if errors.Is(err, io.EOF) {
+		return n, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return n, err
+	}
+
+	if c.remaining == 0 {
+		if err = c.expectCRLF(); err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+func (c *chunkedReader) nextChunk() (int64, error) {
+	line, err := c.line()
+	if err != nil {
+		return 0, err
+	}
+
+	size, _, _ := strings.Cut(line, ";")
+
+	parsed, err := strconv.ParseInt(strings.TrimSpace(size), 16, 64)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("%w: bad chunk size %q", ErrChunk, size)
+	}
+
+	return parsed, nil
+}
+
+// skipTrailers reads the trailing headers up to the final empty line, the
+// body may also just end after the last chunk.
+func (c *chunkedReader) skipTrailers() error {
+	for {
+		line, err := c.line()
+		if errors.Is(err, io.EOF) || (err == nil && line == "") {
+			return io.EOF
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *chunkedReader) line() (string, error) {
+	var line []byte
+
+	for {
+		fragment, isPrefix, err := c.reader.ReadLine()
+		if err != nil {
+			return "", err
+		}
+
+		line = append(line, fragment...)
+		if len(line) > maxChunkHeader {
+			return "", fmt.Errorf("%w: the chunk header is too long", ErrChunk)
+		}
+
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+func (c *chunkedReader) expectCRLF() error {
+	line, err := c.line()
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrChunk, err.Error())
+	}
+
+	if line != "" {
+		return fmt.Errorf("%w: the chunk is longer than its size", ErrChunk)
+	}
+
+	return nil
+}
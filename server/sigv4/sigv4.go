@@ -0,0 +1,357 @@
+// Package sigv4 verifies requests signed with AWS signature version 4, as
+// sent by S3 clients.
+package sigv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Algorithm       = "AWS4-HMAC-SHA256"
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+	// StreamingPrefix starts the payload hash of aws-chunked bodies.
+	StreamingPrefix = "STREAMING-"
+
+	timeFormat = "20060102T150405Z"
+	dateFormat = "20060102"
+	service    = "s3"
+	terminator = "aws4_request"
+
+	// maxSkew is how far the clock of a client may drift from ours.
+	maxSkew = 15 * time.Minute
+	// maxExpires is the longest a presigned url may be valid, in seconds.
+	maxExpires = 7 * 24 * 60 * 60
+)
+
+var (
+	ErrMissing         = errors.New("the request is not signed")
+	ErrMalformed       = errors.New("the signature of the request is malformed")
+	ErrUnknownKey      = errors.New("the access key is unknown")
+	ErrSignature       = errors.New("the signature does not match")
+	ErrExpired         = errors.New("the request is too old or expired")
+	ErrPayloadMismatch = errors.New("the payload does not match its signed hash")
+)
+
+// Verifier checks the signatures of requests against known access keys.
+type Verifier struct {
+	Region string
+	// Credentials maps access keys to their secret keys.
+	Credentials map[string]string
+	// Now returns the current time, it defaults to time.Now.
+	Now func() time.Time
+}
+
+// Signature is the parsed signature of a request.
+type Signature struct {
+	AccessKey string
+	// PayloadHash is the hex sha256 of the body, UnsignedPayload or a
+	// streaming marker.
+	PayloadHash string
+
+	date          time.Time
+	scopeDate     string
+	region        string
+	service       string
+	signedHeaders []string
+	signature     string
+	presigned     bool
+	expires       time.Duration
+}
+
+// Verify authenticates r with the Authorization header or the query of a
+// presigned url.
+func (v *Verifier) Verify(r *http.Request) (*Signature, error) {
+	var signature *Signature
+	var err error
+
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, Algorithm+" ") {
+		signature, err = parseHeader(r, auth)
+	} else if r.URL.Query().Get("X-Amz-Algorithm") == Algorithm {
+		signature, err = parseQuery(r)
+	} else {
+		return nil, ErrMissing
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = v.checkScope(signature); err != nil {
+		return nil, err
+	}
+
+	secret, found := v.Credentials[signature.AccessKey]
+	if !found {
+		return nil, ErrUnknownKey
+	}
+
+	expected := sign(secret, signature, stringToSign(signature, canonicalRequest(r, signature)))
+	if !hmac.Equal([]byte(expected), []byte(signature.signature)) {
+		return nil, ErrSignature
+	}
+
+	return signature, nil
+}
+
+func (v *Verifier) checkScope(signature *Signature) error {
+	if signature.region != v.Region || signature.service != service ||
+		signature.scopeDate != signature.date.Format(dateFormat) {
+		return ErrMalformed
+	}
+
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+
+	current := now().UTC()
+
+	if signature.date.After(current.Add(maxSkew)) {
+		return ErrExpired
+	}
+
+	if signature.presigned {
+		if current.After(signature.date.Add(signature.expires)) {
+			return ErrExpired
+		}
+	} else if signature.date.Before(current.Add(-maxSkew)) {
+		return ErrExpired
+	}
+
+	return nil
+}
+
+func parseHeader(r *http.Request, auth string) (*Signature, error) {
+	signature := &Signature{PayloadHash: r.Header.Get("X-Amz-Content-Sha256")}
+
+	for _, field := range strings.Split(strings.TrimPrefix(auth, Algorithm+" "), ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(field), "=")
+		if !found {
+			return nil, ErrMalformed
+		}
+
+		switch key {
+		case "Credential":
+			if err := signature.parseCredential(value); err != nil {
+				return nil, err
+			}
+		case "SignedHeaders":
+			signature.signedHeaders = strings.Split(value, ";")
+		case "Signature":
+			signature.signature = value
+		}
+	}
+
+	date, err := requestDate(r.Header.Get("X-Amz-Date"), r.Header.Get("Date"))
+	if err != nil {
+		return nil, err
+	}
+
+	signature.date = date
+
+	if signature.PayloadHash == "" {
+		return nil, ErrMalformed
+	}
+
+	return signature, signature.validate()
+}
+
+func parseQuery(r *http.Request) (*Signature, error) {
+	query := r.URL.Query()
+
+	signature := &Signature{
+		PayloadHash:   UnsignedPayload,
+		presigned:     true,
+		signedHeaders: strings.Split(query.Get("X-Amz-SignedHeaders"), ";"),
+		signature:     query.Get("X-Amz-Signature"),
+	}
+
+	if hash := query.Get("X-Amz-Content-Sha256"); hash != "" {
+		signature.PayloadHash = hash
+	}
+
+	if err := signature.parseCredential(query.Get("X-Amz-Credential")); err != nil {
+		return nil, err
+	}
+
+	date, err := requestDate(query.Get("X-Amz-Date"), "")
+	if err != nil {
+		return nil, err
+	}
+
+	signature.date = date
+
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || expires < 0 || expires > maxExpires {
+		return nil, ErrMalformed
+	}
+
+	signature.expires = time.Duration(expires) * time.Second
+
+	return signature, signature.validate()
+}
+
+func (s *Signature) parseCredential(credential string) error {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[4] != terminator {
+		return ErrMalformed
+	}
+
+	s.AccessKey, s.scopeDate, s.region, s.service = parts[0], parts[1], parts[2], parts[3]
+
+	return nil
+}
+
+func (s *Signature) validate() error {
+	if s.AccessKey == "" || s.signature == "" {
+		return ErrMalformed
+	}
+
+	for _, header := range s.signedHeaders {
+		if header == "host" {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: the host header must be signed", ErrMalformed)
+}
+
+func requestDate(amzDate string, date string) (time.Time, error) {
+	if amzDate != "" {
+		parsed, err := time.Parse(timeFormat, amzDate)
+		if err != nil {
+			return time.Time{}, ErrMalformed
+		}
+
+		return parsed, nil
+	}
+
+	parsed, err := http.ParseTime(date)
+	if err != nil {
+		return time.Time{}, ErrMalformed
+	}
+
+	return parsed.UTC(), nil
+}
+
+func canonicalRequest(r *http.Request, signature *Signature) string {
+	var headers strings.Builder
+
+	for _, name := range signature.signedHeaders {
+		headers.WriteString(name)
+		headers.WriteByte(':')
+		headers.WriteString(headerValue(r, name))
+		headers.WriteByte('\n')
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		Escape(r.URL.Path, false),
+		canonicalQuery(r.URL.Query(), signature.presigned),
+		headers.String(),
+		strings.Join(signature.signedHeaders, ";"),
+		signature.PayloadHash,
+	}, "\n")
+}
+
+func headerValue(r *http.Request, name string) string {
+	var values []string
+
+	switch name {
+	case "host":
+		values = []string{r.Host}
+	case "transfer-encoding":
+		values = r.TransferEncoding
+	case "content-length":
+		values = r.Header.Values(name)
+		if len(values) == 0 && r.ContentLength >= 0 {
+			values = []string{strconv.FormatInt(r.ContentLength, 10)}
+		}
+	default:
+		values = r.Header.Values(name)
+	}
+
+	for i, value := range values {
+		values[i] = strings.Join(strings.Fields(value), " ")
+	}
+
+	return strings.Join(values, ",")
+}
+
+func canonicalQuery(query url.Values, presigned bool) string {
+	pairs := make([]string, 0, len(query))
+
+	for key, values := range query {
+		if presigned && key == "X-Amz-Signature" {
+			continue
+		}
+
+		sorted := append([]string{}, values...)
+		sort.Strings(sorted)
+
+		for _, value := range sorted {
+			pairs = append(pairs, Escape(key, true)+"="+Escape(value, true))
+		}
+	}
+
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, "&")
+}
+
+func stringToSign(signature *Signature, canonical string) string {
+	hash := sha256.Sum256([]byte(canonical))
+
+	return strings.Join([]string{
+		Algorithm,
+		signature.date.Format(timeFormat),
+		strings.Join([]string{signature.scopeDate, signature.region, signature.service, terminator}, "/"),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+}
+
+func sign(secret string, signature *Signature, toSign string) string {
+	key := hmacSHA256([]byte("AWS4"+secret), signature.scopeDate)
+	key = hmacSHA256(key, signature.region)
+	key = hmacSHA256(key, signature.service)
+	key = hmacSHA256(key, terminator)
+
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+// Escape percent encodes s the way AWS does, every byte but the unreserved
+// characters is encoded, and slashes only when encodeSlash is set.
+func Escape(s string, encodeSlash bool) string {
+	var escaped strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			escaped.WriteByte(c)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+
+	return escaped.String()
+}
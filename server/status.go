@@ -2,20 +2,47 @@ package server
 
 import (
 	"encoding/json"
-	"net/http"
 
 	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/yakiroren/dss-common/models"
 )
 
 const (
 	Done     = "done"
 	Progress = "in progress"
+	Failed   = "failed"
 )
 
 type Status struct {
-	State             string `json:"State"`
-	TotalFragments    int    `json:"TotalFragments"`
+	State string `json:"State"`
+	// TotalFragments is null while the length of the upload is unknown.
+	TotalFragments    *int   `json:"TotalFragments"`
 	UploadedFragments int    `json:"UploadedFragments"`
+	Error             string `json:"Error,omitempty"`
+}
+
+// isProcessing reports whether fragments of the file are still being uploaded.
+func isProcessing(metadata *models.FileMetadata) bool {
+	return metadata.TotalFragments != len(metadata.Fragments)
+}
+
+func newStatus(metadata *models.FileMetadata) Status {
+	state := Done
+	if isProcessing(metadata) {
+		state = Progress
+	}
+
+	var totalFragments *int
+	if metadata.TotalFragments != unknownSize {
+		totalFragments = &metadata.TotalFragments
+	}
+
+	return Status{
+		State:             state,
+		TotalFragments:    totalFragments,
+		UploadedFragments: len(metadata.Fragments),
+	}
 }
 
 func (s *Server) Status(ctx *fiber.Ctx) error {
@@ -24,19 +51,23 @@ func (s *Server) Status(ctx *fiber.Ctx) error {
 	metadata, exists := s.datastore.GetMetadataByID(ctx.Context(), id)
 
 	if !exists {
-		return fiber.NewError(http.StatusNotFound, "file not found")
+		return notFoundError("file not found")
 	}
 
-	state := Done
-	if metadata.TotalFragments != len(metadata.Fragments) {
-		state = Progress
+	status := newStatus(metadata)
+
+	uploadError, err := s.catalog.UploadError(ctx.Context(), id)
+	if err != nil {
+		log.Error(err)
+		return fiber.ErrInternalServerError
 	}
 
-	marshal, err := json.Marshal(Status{
-		State:             state,
-		TotalFragments:    metadata.TotalFragments,
-		UploadedFragments: len(metadata.Fragments),
-	})
+	if uploadError != "" {
+		status.State = Failed
+		status.Error = uploadError
+	}
+
+	marshal, err := json.Marshal(status)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"dss-main/catalog"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	maxTags      = 64
+	maxTagLength = 64
+)
+
+// parseTags reads the tags field of a request, tags can be sent as repeated
+// fields, comma separated, or both.
+func parseTags(ctx *fiber.Ctx) ([]string, error) {
+	var raw []string
+
+	if form, err := ctx.MultipartForm(); err == nil {
+		raw = form.Value["tags"]
+	} else {
+		for _, value := range ctx.Request().PostArgs().PeekMulti("tags") {
+			raw = append(raw, string(value))
+		}
+	}
+
+	for _, value := range ctx.Context().QueryArgs().PeekMulti("tags") {
+		raw = append(raw, string(value))
+	}
+
+	return normalizeTags(raw)
+}
+
+// normalizeTags splits comma separated tags, trims and deduplicates them.
+func normalizeTags(raw []string) ([]string, error) {
+	seen := map[string]bool{}
+	tags := []string{}
+
+	for _, value := range raw {
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "" || seen[tag] {
+				continue
+			}
+
+			if len(tag) > maxTagLength {
+				return nil, fiber.NewError(http.StatusBadRequest, fmt.Sprintf("tags are limited to %d bytes", maxTagLength))
+			}
+
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	if len(tags) > maxTags {
+		return nil, fiber.NewError(http.StatusBadRequest, fmt.Sprintf("a file can have at most %d tags", maxTags))
+	}
+
+	return tags, nil
+}
+
+func (s *Server) AddTags(ctx *fiber.Ctx) error {
+	return s.updateTags(ctx, func(id string, tags []string) error {
+		return s.catalog.AddTags(ctx.Context(), id, tags)
+	})
+}
+
+func (s *Server) RemoveTags(ctx *fiber.Ctx) error {
+	return s.updateTags(ctx, func(id string, tags []string) error {
+		return s.catalog.RemoveTags(ctx.Context(), id, tags)
+	})
+}
+
+func (s *Server) ReplaceTags(ctx *fiber.Ctx) error {
+	return s.updateTags(ctx, func(id string, tags []string) error {
+		return s.datastore.UpdateField(ctx.Context(), id, catalog.FieldTags, tags)
+	})
+}
+
+func (s *Server) updateTags(ctx *fiber.Ctx, update func(id string, tags []string) error) error {
+	id := ctx.Params("id")
+
+	metadata, exists := s.datastore.GetMetadataByID(ctx.Context(), id)
+	if !exists {
+		return notFoundError("file not found")
+	}
+
+	tags, err := parseTags(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err = update(metadata.Id.Hex(), tags); err != nil {
+		log.Error(err)
+		return fiber.ErrInternalServerError
+	}
+
+	metadata, exists = s.datastore.GetMetadataByID(ctx.Context(), id)
+	if !exists {
+		return notFoundError("file not found")
+	}
+
+	return ctx.JSON(fiber.Map{"id": metadata.Id, "tags": metadata.Tags})
+}
+
+// BulkTag adds or removes tags on everything under a path.
+func (s *Server) BulkTag(ctx *fiber.Ctx) error {
+	// an empty path would clean to the root and tag the whole tree.
+	path := ctx.FormValue("path")
+	if path == "" {
+		return fiber.NewError(http.StatusBadRequest, "path cant be empty")
+	}
+
+	targetPath := cleanPath(path)
+
+	valid := validatePath(targetPath)
+	if !valid {
+		return errInvalidPath
+	}
+
+	tags, err := parseTags(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(tags) == 0 {
+		return fiber.NewError(http.StatusBadRequest, "tags cant be empty")
+	}
+
+	var remove bool
+
+	switch ctx.FormValue("op", "add") {
+	case "add":
+	case "remove":
+		remove = true
+	default:
+		return fiber.NewError(http.StatusBadRequest, "op must be add or remove")
+	}
+
+	modified, err := s.catalog.TagSubtree(ctx.Context(), targetPath, tags, remove)
+	if err != nil {
+		log.Error(err)
+		return fiber.ErrInternalServerError
+	}
+
+	return ctx.JSON(fiber.Map{"modified": modified})
+}
+
+func (s *Server) ListTags(ctx *fiber.Ctx) error {
+	counts, err := s.catalog.TagCounts(ctx.Context())
+	if err != nil {
+		log.Error(err)
+		return fiber.ErrInternalServerError
+	}
+
+	return ctx.JSON(counts)
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultTreeDepth = 2
+	maxTreeDepth     = 16
+)
+
+type TreeNode struct {
+	DisplayMetadata
+	Children  []*TreeNode `json:"children,omitempty"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+type DiskUsage struct {
+	Path        string      `json:"path"`
+	Size        string      `json:"size"`
+	Bytes       int64       `json:"bytes"`
+	Files       int64       `json:"files"`
+	Directories int64       `json:"directories"`
+	Fragments   int64       `json:"fragments"`
+	IsDirectory bool        `json:"directory"`
+	Children    []DiskUsage `json:"children,omitempty"`
+}
+
+func (s *Server) Tree(ctx *fiber.Ctx) error {
+	path := wildcardPath(ctx)
+
+	depth := ctx.QueryInt("depth", defaultTreeDepth)
+	if depth < 1 || depth > maxTreeDepth {
+		return fiber.NewError(http.StatusBadRequest, fmt.Sprintf("depth must be between 1 and %d", maxTreeDepth))
+	}
+
+	metadata, exists := s.datastore.GetMetadataByPath(ctx.Context(), path)
+	if !exists {
+		return notFoundError("directory not found")
+	}
+
+	if !metadata.IsDirectory {
+		return invalidPathError("the provided path is not a directory")
+	}
+
+	files, err := s.catalog.Subtree(ctx.Context(), path, depth)
+	if err != nil {
+		log.Error(err)
+		return fiber.ErrInternalServerError
+	}
+
+	root := &TreeNode{DisplayMetadata: newDisplayMetadata(*metadata)}
+	root.Path = path
+
+	nodes := map[string]*TreeNode{path: root}
+	levels := map[string]int{path: 0}
+
+	// files are sorted by path, so every parent is seen before its children.
+	for _, file := range files {
+		parent, found := nodes[file.Path]
+		if !found {
+			continue
+		}
+
+		node := &TreeNode{DisplayMetadata: newDisplayMetadata(file)}
+		parent.Children = append(parent.Children, node)
+
+		if file.IsDirectory {
+			levels[node.Path] = levels[file.Path] + 1
+			if levels[node.Path] == depth {
+				node.Truncated = true
+				continue
+			}
+
+			nodes[node.Path] = node
+		}
+	}
+
+	return ctx.JSON(root)
+}
+
+func (s *Server) DiskUsage(ctx *fiber.Ctx) error {
+	path := wildcardPath(ctx)
+
+	metadata, exists := s.datastore.GetMetadataByPath(ctx.Context(), path)
+	if !exists {
+		return notFoundError("file not found")
+	}
+
+	if !metadata.IsDirectory {
+		return ctx.JSON(DiskUsage{
+			Path:      path,
+			Size:      humanize.IBytes(uint64(metadata.FileSize)),
+			Bytes:     metadata.FileSize,
+			Files:     1,
+			Fragments: int64(len(metadata.Fragments)),
+		})
+	}
+
+	entries, err := s.catalog.Usage(ctx.Context(), path)
+	if err != nil {
+		log.Error(err)
+		return fiber.ErrInternalServerError
+	}
+
+	total := DiskUsage{Path: path, IsDirectory: true, Children: []DiskUsage{}}
+
+	for _, entry := range entries {
+		total.Bytes += entry.Bytes
+		total.Files += entry.Files
+		total.Directories += entry.Directories
+		total.Fragments += entry.Fragments
+
+		total.Children = append(total.Children, DiskUsage{
+			Path:        filepath.Join(path, entry.Name),
+			Size:        humanize.IBytes(uint64(entry.Bytes)),
+			Bytes:       entry.Bytes,
+			Files:       entry.Files,
+			Directories: entry.Directories,
+			Fragments:   entry.Fragments,
+			IsDirectory: entry.IsDirectory,
+		})
+	}
+
+	total.Size = humanize.IBytes(uint64(total.Bytes))
+
+	return ctx.JSON(total)
+}
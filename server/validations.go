@@ -3,76 +3,202 @@ package server
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	maxNameLength = 255
+	maxExtLength  = 32
 )
 
-func (s *Server) fixFilename(ctx context.Context, filename string, path string) string {
+// fixFilename returns filename, or the first free name(n).ext when it is
+// taken in path. Every name(n).ext sibling is fetched with a single query.
+func (s *Server) fixFilename(ctx context.Context, filename string, path string) (string, error) {
 	filename = sanitizeFilename(filename)
 	ext := filepath.Ext(filename)
-	newFilename := filename
+	base := fileNameWithoutExtTrimSuffix(filename)
 
-	i := 1
-	for {
-		_, found := s.datastore.GetMetadataByPath(ctx, fmt.Sprintf("%s/%s", path, newFilename))
-		if !found {
-			return newFilename
-		}
+	pattern := fmt.Sprintf(`^%s(\(\d+\))?%s$`, regexp.QuoteMeta(base), regexp.QuoteMeta(ext))
+
+	names, err := s.catalog.Names(ctx, path, pattern)
+	if err != nil {
+		return "", err
+	}
 
-		newFilename = fileNameWithoutExtTrimSuffix(filename) + fmt.Sprintf("(%d)", i) + ext
-		i++
+	taken := make(map[string]bool, len(names))
+	for _, name := range names {
+		taken[name] = true
 	}
+
+	newFilename := filename
+	for i := 1; taken[newFilename]; i++ {
+		newFilename = base + fmt.Sprintf("(%d)", i) + ext
+	}
+
+	return newFilename, nil
 }
 
 func fileNameWithoutExtTrimSuffix(fileName string) string {
 	return strings.TrimSuffix(fileName, filepath.Ext(fileName))
 }
 
+// sanitizeFilename keeps any printable unicode name, NFC normalized so the
+// same name typed on different systems is stored once. Path separators,
+// control and formatting characters (like bidi overrides) are dropped, and a
+// name that ends up empty or is a traversal segment is replaced by a
+// generated one.
 func sanitizeFilename(filename string) string {
-	// Define a regular expression to match against the filename
-	pattern := "[^a-zA-Z0-9_.-]+"
-	regex := regexp.MustCompile(pattern)
+	sanitized := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || !validRune(r) {
+			return -1
+		}
+		return r
+	}, norm.NFC.String(filename))
 
-	// Replace all spaces with underscores
-	filename = strings.ReplaceAll(filename, " ", "_")
+	sanitized = truncateName(strings.TrimSpace(sanitized))
 
-	// Replace all non-matching characters with an empty string
-	sanitized := regex.ReplaceAllString(filename, "")
+	if sanitized == "" || sanitized == "." || sanitized == ".." {
+		return generatedName(filepath.Ext(filename))
+	}
 
 	return sanitized
 }
 
-func validatePath(path string) bool {
-	// Regular expression pattern for validating Linux paths
-	pattern := `^/([a-zA-Z0-9_-]+/?)*$`
+func validRune(r rune) bool {
+	return r != utf8.RuneError && !unicode.IsControl(r) && !unicode.Is(unicode.Cf, r)
+}
 
-	// Compile the regular expression pattern
-	regex := regexp.MustCompile(pattern)
+func validName(name string) bool {
+	if name == "" || name == "." || name == ".." || len(name) > maxNameLength || !utf8.ValidString(name) {
+		return false
+	}
+
+	for _, r := range name {
+		if r == '/' || r == '\\' || !validRune(r) {
+			return false
+		}
+	}
 
-	// Use the MatchString function to check if the path matches the pattern
-	return regex.MatchString(path)
+	return true
 }
 
-func getPathSegments(path string) []string {
-	// Remove trailing slashes from the path
-	path = strings.TrimSuffix(path, "/")
+// truncateName cuts a name down to maxNameLength bytes on a rune boundary,
+// keeping its extension when it is reasonably short.
+func truncateName(name string) string {
+	if len(name) <= maxNameLength {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	if len(ext) > maxExtLength {
+		ext = ""
+	}
+
+	base := strings.TrimSuffix(name, ext)
+	limit := maxNameLength - len(ext)
+
+	for limit > 0 && !utf8.RuneStart(base[limit]) {
+		limit--
+	}
+
+	return base[:limit] + ext
+}
+
+func generatedName(ext string) string {
+	if !validName("unnamed" + ext) {
+		ext = ""
+	}
 
-	// Split the path into its directory segments
-	segments := strings.Split(path, "/")
+	return "unnamed-" + primitive.NewObjectID().Hex() + ext
+}
+
+// cleanPath NFC normalizes a path and drops its trailing slash, so it
+// matches the way paths are stored.
+func cleanPath(path string) string {
+	path = norm.NFC.String(path)
+
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
 
-	// Reverse the order of the segments
-	for i, j := 0, len(segments)-1; i < j; i, j = i+1, j-1 {
-		segments[i], segments[j] = segments[j], segments[i]
+	return path
+}
+
+// validatePath accepts absolute paths made of valid names, rejecting empty
+// and traversal segments.
+func validatePath(path string) bool {
+	if !strings.HasPrefix(path, "/") {
+		return false
 	}
 
-	// Build an array of paths from root to deepest directory
-	var paths []string
+	if path == "/" {
+		return true
+	}
+
+	for _, segment := range strings.Split(strings.TrimSuffix(path[1:], "/"), "/") {
+		if !validName(segment) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getPathSegments returns every directory on the way to path, from the
+// root down to path itself.
+func getPathSegments(path string) []string {
+	paths := []string{"/"}
+
 	currentPath := ""
-	for i := len(segments) - 1; i >= 0; i-- {
-		currentPath += segments[i] + "/"
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if segment == "" {
+			continue
+		}
+
+		currentPath += "/" + segment
 		paths = append(paths, currentPath)
 	}
 
 	return paths
 }
+
+// formBool parses an optional boolean form value, defaulting to false.
+func formBool(ctx *fiber.Ctx, key string) (bool, error) {
+	value := ctx.FormValue(key)
+	if value == "" {
+		return false, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fiber.NewError(http.StatusBadRequest, key+" must be a boolean")
+	}
+
+	return parsed, nil
+}
+
+// formModTime reads the modification time of an upload in unix seconds,
+// zero when it is missing.
+func formModTime(ctx *fiber.Ctx) (int64, error) {
+	value := ctx.FormValue("mtime")
+	if value == "" {
+		return 0, nil
+	}
+
+	modTime, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || modTime <= 0 {
+		return 0, fiber.NewError(http.StatusBadRequest, "mtime must be a positive unix time")
+	}
+
+	return modTime, nil
+}
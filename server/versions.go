@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"dss-main/catalog"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/yakiroren/dss-common/models"
+)
+
+type VersionMetadata struct {
+	Version      int    `json:"version"`
+	Current      bool   `json:"current"`
+	Size         string `json:"size"`
+	Bytes        int64  `json:"bytes"`
+	CreationTime int64  `json:"creation_time"`
+	ArchivedAt   int64  `json:"archived_at,omitempty"`
+	Fragments    int    `json:"fragments"`
+}
+
+func newVersionMetadata(file models.FileMetadata, version int) VersionMetadata {
+	return VersionMetadata{
+		Version:      version,
+		Size:         humanize.IBytes(uint64(file.FileSize)),
+		Bytes:        file.FileSize,
+		CreationTime: file.CreationTime,
+		Fragments:    len(file.Fragments),
+	}
+}
+
+// versioned reports whether an upload into targetPath should keep the
+// previous version of a file it replaces, the versioning form value
+// overrides the setting of the directory.
+func (s *Server) versioned(ctx *fiber.Ctx, targetPath string) (bool, error) {
+	value := ctx.FormValue("versioning")
+	if value == "" {
+		return s.catalog.Versioning(ctx.Context(), targetPath), nil
+	}
+
+	versioned, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fiber.NewError(http.StatusBadRequest, "versioning must be a boolean")
+	}
+
+	return versioned, nil
+}
+
+// newVersion archives the current content of existing and points it at an
+// upload that is about to be fragmented.
+func (s *Server) newVersion(ctx context.Context, existing *models.FileMetadata, size int64, totalFragments int,
+	tags []string,
+) (string, error) {
+	if isProcessing(existing) {
+		return "", conflictError("the previous version is still being uploaded")
+	}
+
+	version, err := s.catalog.Supersede(ctx, *existing, models.FileMetadata{
+		FileSize:       size,
+		CreationTime:   time.Now().Unix(),
+		Fragments:      []models.Fragment{},
+		TotalFragments: totalFragments,
+		IsHidden:       true,
+	}, "", 0)
+	if err != nil {
+		return "", err
+	}
+
+	if len(tags) > 0 {
+		if err = s.catalog.AddTags(ctx, existing.Id.Hex(), tags); err != nil {
+			return "", err
+		}
+	}
+
+	log.Infof("uploading version %d of %s", version, existing.Id.Hex())
+
+	return existing.Id.Hex(), nil
+}
+
+func (s *Server) ListVersions(ctx *fiber.Ctx) error {
+	metadata, exists := s.datastore.GetMetadataByID(ctx.Context(), ctx.Params("id"))
+	if !exists {
+		return notFoundError("file not found")
+	}
+
+	current, err := s.catalog.CurrentVersion(ctx.Context(), metadata.Id)
+	if err != nil {
+		log.Error(err)
+		return fiber.ErrInternalServerError
+	}
+
+	archived, err := s.catalog.Versions(ctx.Context(), metadata.Id)
+	if err != nil {
+		log.Error(err)
+		return fiber.ErrInternalServerError
+	}
+
+	latest := newVersionMetadata(*metadata, current)
+	latest.Current = true
+
+	versions := []VersionMetadata{latest}
+
+	for _, version := range archived {
+		old := newVersionMetadata(version.File, version.Version)
+		old.ArchivedAt = version.ArchivedAt
+
+		versions = append(versions, old)
+	}
+
+	return ctx.JSON(fiber.Map{"id": metadata.Id, "name": metadata.FileName, "versions": versions})
+}
+
+func (s *Server) version(ctx *fiber.Ctx) (*models.FileMetadata, *catalog.Version, error) {
+	metadata, exists := s.datastore.GetMetadataByID(ctx.Context(), ctx.Params("id"))
+	if !exists {
+		return nil, nil, notFoundError("file not found")
+	}
+
+	number, err := strconv.Atoi(ctx.Params("version"))
+	if err != nil {
+		return nil, nil, fiber.NewError(http.StatusBadRequest, "version must be a number")
+	}
+
+	version, err := s.catalog.Version(ctx.Context(), metadata.Id, number)
+	if errors.Is(err, catalog.ErrVersionNotFound) {
+		return nil, nil, notFoundError(err.Error())
+	} else if err != nil {
+		log.Error(err)
+		return nil, nil, fiber.ErrInternalServerError
+	}
+
+	return metadata, version, nil
+}
+
+func (s *Server) DownloadVersion(ctx *fiber.Ctx) error {
+	metadata, version, err := s.version(ctx)
+	if err != nil {
+		return err
+	}
+
+	reader, err := s.storage.ReadFragments(ctx.Context(), version.File.Fragments)
+	if err != nil {
+		return upstreamError("could not read the fragments", err)
+	}
+
+	ctx.Attachment(metadata.FileName)
+
+	return ctx.SendStream(reader, int(version.File.FileSize))
+}
+
+// RestoreVersion makes an old version the current content of a file, the
+// content it replaces is archived as a version of its own.
+func (s *Server) RestoreVersion(ctx *fiber.Ctx) error {
+	metadata, version, err := s.version(ctx)
+	if err != nil {
+		return err
+	}
+
+	if isProcessing(metadata) {
+		return conflictError("the current version is still being uploaded")
+	}
+
+	restored := version.File
+	restored.IsHidden = false
+
+	current, err := s.catalog.Supersede(ctx.Context(), *metadata, restored, version.Checksum, version.ModTime)
+	if err != nil {
+		log.Error(err)
+		return fiber.ErrInternalServerError
+	}
+
+	return ctx.JSON(fiber.Map{"id": metadata.Id, "version": current, "restored": version.Version})
+}
+
+// PruneVersions deletes archived versions beyond the newest keep versions,
+// or archived longer than older_than ago. The fragments of pruned versions
+// are only dereferenced.
+func (s *Server) PruneVersions(ctx *fiber.Ctx) error {
+	metadata, exists := s.datastore.GetMetadataByID(ctx.Context(), ctx.Params("id"))
+	if !exists {
+		return notFoundError("file not found")
+	}
+
+	keep := ctx.QueryInt("keep", -1)
+
+	var cutoff int64
+	if olderThan := ctx.Query("older_than"); olderThan != "" {
+		age, err := time.ParseDuration(olderThan)
+		if err != nil || age <= 0 {
+			return fiber.NewError(http.StatusBadRequest, "older_than must be a positive duration, like 720h")
+		}
+		cutoff = time.Now().Add(-age).Unix()
+	}
+
+	if keep < 0 && cutoff == 0 {
+		return fiber.NewError(http.StatusBadRequest, "either keep or older_than must be provided")
+	}
+
+	archived, err := s.catalog.Versions(ctx.Context(), metadata.Id)
+	if err != nil {
+		log.Error(err)
+		return fiber.ErrInternalServerError
+	}
+
+	var prune []int
+
+	for i, version := range archived {
+		if (keep >= 0 && i >= keep) || (cutoff != 0 && version.ArchivedAt < cutoff) {
+			prune = append(prune, version.Version)
+		}
+	}
+
+	if len(prune) == 0 {
+		return ctx.JSON(fiber.Map{"deleted": 0})
+	}
+
+	deleted, err := s.catalog.DeleteVersions(ctx.Context(), metadata.Id, prune...)
+	if err != nil {
+		log.Error(err)
+		return fiber.ErrInternalServerError
+	}
+
+	return ctx.JSON(fiber.Map{"deleted": deleted})
+}
+
+// SetVersioning turns versioning of the files in a directory on or off.
+func (s *Server) SetVersioning(ctx *fiber.Ctx) error {
+	metadata, exists := s.datastore.GetMetadataByID(ctx.Context(), ctx.Params("id"))
+	if !exists {
+		return notFoundError("directory not found")
+	}
+
+	if !metadata.IsDirectory {
+		return fiber.NewError(http.StatusBadRequest, "versioning can only be set on directories")
+	}
+
+	enabled, err := strconv.ParseBool(ctx.FormValue("enabled"))
+	if err != nil {
+		return fiber.NewError(http.StatusBadRequest, fmt.Sprintf("enabled must be a boolean, got %q",
+			ctx.FormValue("enabled")))
+	}
+
+	if err = s.catalog.SetVersioning(ctx.Context(), metadata.Id.Hex(), enabled); err != nil {
+		log.Error(err)
+		return fiber.ErrInternalServerError
+	}
+
+	return ctx.JSON(fiber.Map{"id": metadata.Id, "versioning": enabled})
+}
@@ -2,6 +2,7 @@ package ds
 
 import (
 	"context"
+	"errors"
 	"github.com/yakiroren/dss-common/models"
 	"io"
 	"sort"
@@ -22,3 +23,32 @@ func SortFragments(fragments []models.Fragment) []models.Fragment {
 
 	return fragments
 }
+
+// ReadFragmentsAt reads the content of fragments from offset onwards, the
+// fragments that end before offset aren't fetched at all.
+func ReadFragmentsAt(ctx context.Context, client Client, fragments []models.Fragment,
+	offset int64,
+) (io.ReadCloser, error) {
+	sorted := SortFragments(append([]models.Fragment{}, fragments...))
+
+	first := 0
+	skip := offset
+
+	// a fragment without a size stops the search, the rest is skipped by reading.
+	for first < len(sorted) && sorted[first].Size > 0 && skip >= int64(sorted[first].Size) {
+		skip -= int64(sorted[first].Size)
+		first++
+	}
+
+	reader, err := client.ReadFragments(ctx, sorted[first:])
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = io.CopyN(io.Discard, reader, skip); err != nil && !errors.Is(err, io.EOF) {
+		_ = reader.Close()
+		return nil, err
+	}
+
+	return reader, nil
+}
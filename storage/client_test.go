@@ -0,0 +1,70 @@
+package ds_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	ds "dss-main/storage"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yakiroren/dss-common/models"
+)
+
+// memoryClient serves fragments from memory and remembers what was fetched.
+type memoryClient struct {
+	content map[string]string
+	fetched []string
+}
+
+func (c *memoryClient) ReadFragments(_ context.Context, fragments []models.Fragment) (io.ReadCloser, error) {
+	var content bytes.Buffer
+
+	for _, fragment := range ds.SortFragments(fragments) {
+		c.fetched = append(c.fetched, fragment.Name)
+		content.WriteString(c.content[fragment.Name])
+	}
+
+	return io.NopCloser(&content), nil
+}
+
+func Test_readFragmentsAt(t *testing.T) {
+	fragments := []models.Fragment{{Name: "3", Size: 2}, {Name: "1", Size: 4}, {Name: "2", Size: 4}}
+
+	tests := []struct {
+		offset  int64
+		content string
+		fetched []string
+	}{
+		{offset: 0, content: "abcdefghij", fetched: []string{"1", "2", "3"}},
+		{offset: 3, content: "defghij", fetched: []string{"1", "2", "3"}},
+		{offset: 4, content: "efghij", fetched: []string{"2", "3"}},
+		{offset: 9, content: "j", fetched: []string{"3"}},
+		{offset: 10, content: "", fetched: nil},
+	}
+
+	for _, test := range tests {
+		client := &memoryClient{content: map[string]string{"1": "abcd", "2": "efgh", "3": "ij"}}
+
+		reader, err := ds.ReadFragmentsAt(context.Background(), client, fragments, test.offset)
+		require.NoError(t, err)
+
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		require.Equal(t, test.content, string(content), "offset %d", test.offset)
+		require.Equal(t, test.fetched, client.fetched, "offset %d", test.offset)
+	}
+}
+
+func Test_readFragmentsAtWithoutSizes(t *testing.T) {
+	client := &memoryClient{content: map[string]string{"1": "abcd", "2": "efgh"}}
+	fragments := []models.Fragment{{Name: "1"}, {Name: "2"}}
+
+	reader, err := ds.ReadFragmentsAt(context.Background(), client, fragments, 6)
+	require.NoError(t, err)
+
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "gh", string(content))
+}